@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/audit"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// prRef matches org/repo#number, the number is optional.
+var prRef = regexp.MustCompile(`^([^/#]+)/([^/#]+)(?:#([0-9]+))?$`)
+
+// auditFlags are the flags setting up the audit log of the changes made to
+// PRs.
+type auditFlags struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+}
+
+func (f *auditFlags) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.path, "audit-log", "", "Path to the JSONL file recording every change made to PRs. No audit log is kept if empty.")
+	fs.Int64Var(&f.maxSize, "audit-log-max-size", 100, "Size in MiB after which the audit log is rotated, 0 disables rotation.")
+	fs.IntVar(&f.maxBackups, "audit-log-max-backups", 5, "Number of rotated audit log files to keep.")
+}
+
+// open opens the audit log, it returns nil if there's none.
+func (f *auditFlags) open() (*audit.FileSink, error) {
+	if len(f.path) == 0 {
+		return nil, nil
+	}
+	return audit.NewFileSink(f.path, f.maxSize*1024*1024, f.maxBackups)
+}
+
+// auditLog prints the records of the audit log for a PR, or for all the PRs
+// of a repo.
+func auditLog(args []string) int {
+	var path, pr, format string
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s audit --pr org/repo#number [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&path, "audit-log", "", "Path to the audit log, its rotated files are read too.")
+	fs.StringVar(&pr, "pr", "", "PR to print the records of as org/repo#number, or org/repo for all the PRs of the repo.")
+	fs.StringVar(&format, "format", "text", "Output format, one of text or json.")
+	fs.Parse(args)
+
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+	log := logrus.StandardLogger().WithField("plugin", plugin.PluginName)
+
+	if len(path) == 0 {
+		log.Error("--audit-log is required.")
+		return 2
+	}
+	m := prRef.FindStringSubmatch(pr)
+	if m == nil {
+		log.Errorf("Invalid --pr %q, it must be org/repo#number or org/repo.", pr)
+		return 2
+	}
+	num := 0
+	if len(m[3]) > 0 {
+		num, _ = strconv.Atoi(m[3])
+	}
+	var write func(io.Writer, []audit.Record) error
+	switch format {
+	case "text":
+		write = writeTextAudit
+	case "json":
+		write = writeJSONAudit
+	default:
+		log.Errorf("Invalid --format %q, it must be text or json.", format)
+		return 2
+	}
+
+	records, err := audit.Read(path, func(r audit.Record) bool {
+		return strings.EqualFold(r.Org, m[1]) && strings.EqualFold(r.Repo, m[2]) && (num == 0 || r.Number == num)
+	})
+	if err != nil {
+		log.WithError(err).Error("Error reading audit log.")
+		return 2
+	}
+	if err := write(os.Stdout, records); err != nil {
+		log.WithError(err).Error("Error writing records.")
+		return 2
+	}
+	return 0
+}
+
+func writeTextAudit(w io.Writer, records []audit.Record) error {
+	for _, r := range records {
+		change := r.Action
+		if len(r.Detail) > 0 {
+			change += " " + r.Detail
+		}
+		if r.Shadow {
+			change += " (shadow)"
+		} else if r.DryRun {
+			change += " (dry run)"
+		}
+		source := "scan " + r.ScanID
+		if len(r.EventGUID) > 0 {
+			source = "event " + r.EventGUID
+		}
+		var broken []string
+		for _, v := range r.Rules {
+			if !v.Passed {
+				broken = append(broken, v.Rule+" ("+v.Severity+")")
+			}
+		}
+		line := fmt.Sprintf("%s %s/%s#%d %s, %s, title %q", r.Time.Format("2006-01-02T15:04:05Z07:00"), r.Org, r.Repo, r.Number, change, source, r.Title)
+		if len(r.Verdict) > 0 {
+			line += ", " + r.Verdict
+		}
+		if len(broken) > 0 {
+			line += ", broke " + strings.Join(broken, ", ")
+		}
+		if len(r.ConfigHash) > 0 {
+			line += ", config " + r.ConfigHash
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONAudit(w io.Writer, records []audit.Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/config"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+)
+
+type checkOptions struct {
+	pluginConfig string
+	repo         string
+	baseBranch   string
+	output       string
+}
+
+type checkResult struct {
+	Title string `json:"title"`
+	*plugin.Evaluation
+}
+
+// check evaluates titles against the rules in a plugins.yaml without
+// starting the server. Titles are read from the arguments, or one per line
+// from stdin when there are none or the only one is "-". It returns 1 if
+// any title fails.
+func check(args []string) int {
+	o := checkOptions{}
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check [flags] [title...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.pluginConfig, "plugin-config", "/etc/plugins/plugins.yaml", "Path to the plugin config file.")
+	fs.StringVar(&o.repo, "repo", "", "The org/repo the titles are for.")
+	fs.StringVar(&o.baseBranch, "base-branch", "", "The base branch the titles are for.")
+	fs.StringVar(&o.output, "output", "text", "Output format, either text or json.")
+	fs.Parse(args)
+
+	org, repo, err := splitRepo(o.repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --repo: %v\n", err)
+		return 2
+	}
+	if o.output != "text" && o.output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, it must be text or json\n", o.output)
+		return 2
+	}
+
+	pca := config.NewPluginConfigAgent()
+	if err := pca.Load(o.pluginConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s config from %q: %v\n", plugin.PluginName, o.pluginConfig, err)
+		return 2
+	}
+
+	titles := fs.Args()
+	if len(titles) == 0 || (len(titles) == 1 && titles[0] == "-") {
+		if titles, err = readTitles(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading titles: %v\n", err)
+			return 2
+		}
+	}
+
+	var results []checkResult
+	failed := false
+	for _, title := range titles {
+		evaluation, err := pca.GetPlugin().Evaluate(org, repo, o.baseBranch, title)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error evaluating %q: %v\n", title, err)
+			return 2
+		}
+		failed = failed || !evaluation.Passed()
+		results = append(results, checkResult{Title: title, Evaluation: evaluation})
+	}
+
+	// Title policy files are only loaded for PRs by the plugin server.
+	fmt.Fprintf(os.Stderr, "Checking titles with the central rules, the %s file of %s/%s isn't loaded.\n", plugin.RepoConfigPath, org, repo)
+
+	if o.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			return 2
+		}
+	} else {
+		for _, r := range results {
+			fmt.Printf("%s: %s\n", strings.ToUpper(r.Verdict), r.Title)
+			for _, f := range r.Failures {
+				fmt.Printf("  %s\n", strings.ReplaceAll(strings.TrimSpace(f.Message), "\n", "\n  "))
+			}
+			if len(r.SuggestedTitle) > 0 {
+				fmt.Printf("  Suggested title: %s\n", r.SuggestedTitle)
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// readTitles reads one title per line, skipping empty lines.
+func readTitles(r io.Reader) ([]string, error) {
+	var titles []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if title := strings.TrimRight(scanner.Text(), "\r"); len(strings.TrimSpace(title)) > 0 {
+			titles = append(titles, title)
+		}
+	}
+	return titles, scanner.Err()
+}
+
+// splitRepo splits an org/repo string.
+func splitRepo(s string) (string, string, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", fmt.Errorf("%q is not in org/repo format", s)
+	}
+	return parts[0], parts[1], nil
+}
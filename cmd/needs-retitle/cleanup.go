@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/config"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	pluginsflagutil "k8s.io/test-infra/prow/flagutil/plugins"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+type cleanupOptions struct {
+	pluginConfig pluginsflagutil.PluginOptions
+	dryRun       bool
+	github       prowflagutil.GitHubOptions
+
+	orgs  prowflagutil.Strings
+	audit auditFlags
+}
+
+// cleanup removes the needs-retitle label and the bot comments from the
+// open PRs in repos that don't enable the plugin anymore. It prints the
+// actions taken, or the ones that would be taken in dry run, and returns 1
+// if any PR couldn't be cleaned up.
+func cleanup(args []string) int {
+	o := cleanupOptions{orgs: prowflagutil.NewStrings()}
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cleanup [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Only print the actions that would be taken.")
+	fs.Var(&o.orgs, "org", "Org the cleanup may touch, can be passed multiple times.")
+	o.audit.AddFlags(fs)
+	o.pluginConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.pluginConfig} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+	log := logrus.StandardLogger().WithField("plugin", plugin.PluginName)
+
+	if len(o.orgs.Strings()) == 0 {
+		log.Error("At least one --org is required.")
+		return 2
+	}
+	if err := o.github.Validate(o.dryRun); err != nil {
+		log.WithError(err).Error("Invalid options.")
+		return 2
+	}
+
+	if err := secret.Add(o.github.TokenPath); err != nil {
+		log.WithError(err).Error("Error starting secrets agent.")
+		return 2
+	}
+
+	pa, err := o.pluginConfig.PluginAgent()
+	if err != nil {
+		log.WithError(err).Error("Error loading plugin config.")
+		return 2
+	}
+
+	pca := config.NewPluginConfigAgent()
+	if err := pca.Load(o.pluginConfig.PluginConfigPath); err != nil {
+		log.WithError(err).Errorf("Error loading %s config from %q.", plugin.PluginName, o.pluginConfig.PluginConfigPath)
+		return 2
+	}
+
+	sink, err := o.audit.open()
+	if err != nil {
+		log.WithError(err).Errorf("Error opening audit log %q.", o.audit.path)
+		return 2
+	}
+	if sink != nil {
+		defer func() {
+			if err := sink.Close(); err != nil {
+				log.WithError(err).Error("Error closing audit log.")
+			}
+		}()
+		pca.GetPlugin().SetAuditSink(sink)
+	}
+
+	githubClient, err := o.github.GitHubClient(o.dryRun)
+	if err != nil {
+		log.WithError(err).Error("Error getting GitHub client.")
+		return 2
+	}
+	githubClient.Throttle(360, 360)
+
+	result, err := pca.GetPlugin().Cleanup(log, githubClient, pa.Config(), o.orgs.Strings(), o.dryRun)
+	if err != nil {
+		log.WithError(err).Error("Error cleaning up PRs.")
+		return 2
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.WithError(err).Error("Error writing result.")
+		return 2
+	}
+	if err := result.Err(); err != nil {
+		log.WithError(err).Error("Some PRs couldn't be cleaned up.")
+		return 1
+	}
+	return 0
+}
+
+// enabledRepos returns a key identifying the orgs and repos that enable the
+// plugin, to find out when they change.
+func enabledRepos(config *plugins.Configuration) string {
+	orgs, repos := config.EnabledReposForExternalPlugin(plugin.PluginName)
+	enabled := append(orgs, repos...)
+	sort.Strings(enabled)
+	return strings.Join(enabled, ",")
+}
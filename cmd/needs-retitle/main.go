@@ -28,6 +28,7 @@ import (
 	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
 	"github.com/ouzi-dev/needs-retitle/pkg/server"
 	"github.com/ouzi-dev/needs-retitle/pkg/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"k8s.io/test-infra/prow/interrupts"
 
@@ -40,15 +41,23 @@ import (
 )
 
 type options struct {
-	port int
+	port       int
+	healthPort int
+	adminPort  int
 
 	pluginConfig pluginsflagutil.PluginOptions
 	dryRun       bool
 	github       prowflagutil.GitHubOptions
 
-	updatePeriod time.Duration
+	updatePeriod   time.Duration
+	rescanDebounce time.Duration
+	scan           scanFlags
+	cleanupOrgs    prowflagutil.Strings
 
 	webhookSecretFile string
+	adminTokenFile    string
+
+	audit auditFlags
 }
 
 func (o *options) Validate() error {
@@ -62,12 +71,19 @@ func (o *options) Validate() error {
 }
 
 func gatherOptions() options {
-	o := options{}
+	o := options{cleanupOrgs: prowflagutil.NewStrings()}
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fs.IntVar(&o.port, "port", 8888, "Port to listen on.")
-	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
-	fs.DurationVar(&o.updatePeriod, "update-period", time.Hour*24, "Period duration for periodic scans of all PRs.")
+	fs.IntVar(&o.healthPort, "health-port", 8081, "Port to serve the /healthz and /readyz endpoints on.")
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Only plans the changes to PRs, the plans are logged and served by the admin API.")
+	fs.DurationVar(&o.updatePeriod, "update-period", time.Hour*24, "Period duration for periodic scans of all PRs, 0 disables them.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file", "/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
+	fs.DurationVar(&o.rescanDebounce, "rescan-debounce", time.Minute, "Time to wait after a config change before scanning the orgs and repos whose rules changed, 0 disables these scans.")
+	o.scan.AddFlags(fs)
+	fs.Var(&o.cleanupOrgs, "cleanup-org", "Org where PRs are cleaned up when their repo disables the plugin, can be passed multiple times. No cleanup is done if empty.")
+	fs.IntVar(&o.adminPort, "admin-port", 8082, "Port to serve the admin API on.")
+	fs.StringVar(&o.adminTokenFile, "admin-token-file", "", "Path to the file containing the bearer token for the admin API. The admin API is disabled if empty.")
+	o.audit.AddFlags(fs)
 
 	o.pluginConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
 
@@ -78,7 +94,24 @@ func gatherOptions() options {
 	return o
 }
 
+// subcommands maps the name of each subcommand to the function running it,
+// which gets the remaining arguments and returns the exit code.
+var subcommands = map[string]func(args []string) int{
+	"audit":           auditLog,
+	"check":           check,
+	"cleanup":         cleanup,
+	"report":          report,
+	"scan":            scan,
+	"validate-config": validateConfig,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	o := gatherOptions()
 	if err := o.Validate(); err != nil {
 		logrus.Fatalf("Invalid options: %v", err)
@@ -90,7 +123,11 @@ func main() {
 
 	log.Infof("Starting plugin %s %s", plugin.PluginName, version.GetVersion())
 
-	if err := secret.Add(o.github.TokenPath, o.webhookSecretFile); err != nil {
+	secrets := []string{o.github.TokenPath, o.webhookSecretFile}
+	if len(o.adminTokenFile) > 0 {
+		secrets = append(secrets, o.adminTokenFile)
+	}
+	if err := secret.Add(secrets...); err != nil {
 		logrus.WithError(err).Fatal("Error starting secrets agent.")
 	}
 
@@ -103,6 +140,19 @@ func main() {
 	if err := pca.Start(o.pluginConfig.PluginConfigPath); err != nil {
 		log.WithError(err).Fatalf("Error loading %s config from %q.", plugin.PluginName, o.pluginConfig.PluginConfigPath)
 	}
+	pca.GetPlugin().SetScanOptions(o.scan.Options())
+	pca.GetPlugin().SetDryRun(o.dryRun)
+
+	if sink, err := o.audit.open(); err != nil {
+		log.WithError(err).Fatalf("Error opening audit log %q.", o.audit.path)
+	} else if sink != nil {
+		interrupts.OnInterrupt(func() {
+			if err := sink.Close(); err != nil {
+				log.WithError(err).Error("Error closing audit log.")
+			}
+		})
+		pca.GetPlugin().SetAuditSink(sink)
+	}
 
 	githubClient, err := o.github.GitHubClient(o.dryRun)
 	if err != nil {
@@ -114,17 +164,63 @@ func main() {
 
 	defer interrupts.WaitForGracefulShutdown()
 
-	interrupts.TickLiteral(func() {
-		start := time.Now()
-		if err := pca.GetPlugin().HandleAll(log, githubClient, pa.Config()); err != nil {
-			log.WithError(err).Error("Error during periodic update of all PRs.")
-		}
-		log.WithField("duration", fmt.Sprintf("%v", time.Since(start))).Info("Periodic update complete.")
-	}, o.updatePeriod)
+	if o.updatePeriod > 0 {
+		interrupts.TickLiteral(func() {
+			start := time.Now()
+			if err := o.scan.run(log, pca.GetPlugin(), githubClient, pa.Config()); err != nil {
+				log.WithError(err).Error("Error during periodic update of all PRs.")
+			}
+			log.WithField("duration", fmt.Sprintf("%v", time.Since(start))).Info("Periodic update complete.")
+		}, o.updatePeriod)
+	}
+
+	if o.rescanDebounce > 0 {
+		rescanner := plugin.NewRescanner(log, githubClient, pca.GetPlugin(), pa.Config, o.rescanDebounce)
+		pca.Subscribe(func(prev, next *config.Snapshot) {
+			orgs, repos := pa.Config().EnabledReposForExternalPlugin(plugin.PluginName)
+			if changed := config.ChangedRules(prev.Configuration, next.Configuration, orgs, repos); len(changed) > 0 {
+				log.WithField("changed", changed).Info("Rules changed, scheduling a rescan.")
+				rescanner.Trigger(changed)
+			}
+		})
+	}
+
+	if cleanupOrgs := o.cleanupOrgs.Strings(); len(cleanupOrgs) > 0 {
+		// Clean up on start and whenever the enabled orgs and repos change.
+		var lastEnabled *string
+		interrupts.TickLiteral(func() {
+			config := pa.Config()
+			enabled := enabledRepos(config)
+			if lastEnabled != nil && *lastEnabled == enabled {
+				return
+			}
+			result, err := pca.GetPlugin().Cleanup(log, githubClient, config, cleanupOrgs, o.dryRun)
+			if err == nil {
+				err = result.Err()
+			}
+			if err != nil {
+				log.WithError(err).Error("Error cleaning up PRs in disabled repos.")
+				return
+			}
+			lastEnabled = &enabled
+		}, time.Minute)
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/", s)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/validate", server.NewValidator(log, pca.GetPlugin()))
 	externalplugins.ServeExternalPluginHelp(mux, log, plugin.HelpProvider)
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux}
 	interrupts.ListenAndServe(httpServer, 5*time.Second)
+
+	health := server.NewHealth(githubClient, pca, pca.GetPlugin(), log)
+	healthServer := &http.Server{Addr: ":" + strconv.Itoa(o.healthPort), Handler: health.ServeMux()}
+	interrupts.ListenAndServe(healthServer, 5*time.Second)
+
+	if len(o.adminTokenFile) > 0 {
+		admin := server.NewAdmin(secret.GetTokenGenerator(o.adminTokenFile), githubClient, log, pca.GetPlugin(), pa.Config)
+		adminServer := &http.Server{Addr: ":" + strconv.Itoa(o.adminPort), Handler: admin}
+		interrupts.ListenAndServe(adminServer, 5*time.Second)
+	}
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/config"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	pluginsflagutil "k8s.io/test-infra/prow/flagutil/plugins"
+)
+
+type reportOptions struct {
+	pluginConfig pluginsflagutil.PluginOptions
+	github       prowflagutil.GitHubOptions
+
+	org    string
+	repo   string
+	format string
+	output string
+}
+
+// repoSummary counts the open and failing PRs of a repo.
+type repoSummary struct {
+	Repo    string `json:"repo"`
+	Open    int    `json:"open"`
+	Failing int    `json:"failing"`
+}
+
+var reportWriters = map[string]func(io.Writer, []plugin.ReportEntry) error{
+	"csv":      writeCSVReport,
+	"json":     writeJSONReport,
+	"markdown": writeMarkdownReport,
+}
+
+// report evaluates all the open PRs without changing them and writes a
+// compliance report.
+func report(args []string) int {
+	o := reportOptions{}
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.org, "org", "", "Only report the open PRs in this org.")
+	fs.StringVar(&o.repo, "repo", "", "Only report the open PRs in this repo, requires --org.")
+	fs.StringVar(&o.format, "format", "csv", "Report format, one of csv, json or markdown.")
+	fs.StringVar(&o.output, "output", "", "Path to write the report to, stdout if empty.")
+	o.pluginConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.pluginConfig} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+	log := logrus.StandardLogger().WithField("plugin", plugin.PluginName)
+
+	write, ok := reportWriters[o.format]
+	if !ok {
+		log.Errorf("Invalid --format %q, it must be csv, json or markdown.", o.format)
+		return 2
+	}
+	// The report never mutates anything, so the client always runs in dry
+	// run mode.
+	if err := o.github.Validate(true); err != nil {
+		log.WithError(err).Error("Invalid options.")
+		return 2
+	}
+
+	if err := secret.Add(o.github.TokenPath); err != nil {
+		log.WithError(err).Error("Error starting secrets agent.")
+		return 2
+	}
+
+	pa, err := o.pluginConfig.PluginAgent()
+	if err != nil {
+		log.WithError(err).Error("Error loading plugin config.")
+		return 2
+	}
+
+	pca := config.NewPluginConfigAgent()
+	if err := pca.Load(o.pluginConfig.PluginConfigPath); err != nil {
+		log.WithError(err).Errorf("Error loading %s config from %q.", plugin.PluginName, o.pluginConfig.PluginConfigPath)
+		return 2
+	}
+
+	githubClient, err := o.github.GitHubClient(true)
+	if err != nil {
+		log.WithError(err).Error("Error getting GitHub client.")
+		return 2
+	}
+	githubClient.Throttle(360, 360)
+
+	entries, err := pca.GetPlugin().Report(log, githubClient, pa.Config(), plugin.Scope{Org: o.org, Repo: o.repo})
+	if err != nil {
+		log.WithError(err).Error("Error evaluating PRs.")
+		return 2
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Repo != entries[j].Repo {
+			return entries[i].Repo < entries[j].Repo
+		}
+		return entries[i].Number < entries[j].Number
+	})
+
+	out := os.Stdout
+	if len(o.output) > 0 {
+		if out, err = os.Create(o.output); err != nil {
+			log.WithError(err).Error("Error creating report file.")
+			return 2
+		}
+		defer out.Close()
+	}
+	if err := write(out, entries); err != nil {
+		log.WithError(err).Error("Error writing report.")
+		return 2
+	}
+	return 0
+}
+
+func summarise(entries []plugin.ReportEntry) []repoSummary {
+	var summaries []repoSummary
+	for _, e := range entries {
+		if len(summaries) == 0 || summaries[len(summaries)-1].Repo != e.Repo {
+			summaries = append(summaries, repoSummary{Repo: e.Repo})
+		}
+		s := &summaries[len(summaries)-1]
+		s.Open++
+		if e.Verdict == plugin.VerdictFail {
+			s.Failing++
+		}
+	}
+	return summaries
+}
+
+func writeCSVReport(w io.Writer, entries []plugin.ReportEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repo", "number", "author", "title", "verdict", "failing_rules", "label_correct"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Repo,
+			strconv.Itoa(e.Number),
+			e.Author,
+			e.Title,
+			e.Verdict,
+			strings.Join(e.FailingRules, ";"),
+			strconv.FormatBool(e.LabelCorrect),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJSONReport(w io.Writer, entries []plugin.ReportEntry) error {
+	if entries == nil {
+		entries = []plugin.ReportEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Repos []repoSummary        `json:"repos"`
+		PRs   []plugin.ReportEntry `json:"prs"`
+	}{
+		Repos: summarise(entries),
+		PRs:   entries,
+	})
+}
+
+func writeMarkdownReport(w io.Writer, entries []plugin.ReportEntry) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ", "\r", "")
+	fmt.Fprintf(w, "# %s report\n\n", plugin.PluginName)
+	fmt.Fprint(w, "| Repo | Open PRs | Failing PRs |\n| --- | ---: | ---: |\n")
+	for _, s := range summarise(entries) {
+		fmt.Fprintf(w, "| %s | %d | %d |\n", s.Repo, s.Open, s.Failing)
+	}
+	fmt.Fprint(w, "\n| Repo | PR | Author | Title | Verdict | Failing rules | Label correct |\n| --- | ---: | --- | --- | --- | --- | --- |\n")
+	for _, e := range entries {
+		_, err := fmt.Fprintf(w, "| %s | #%d | %s | %s | %s | %s | %t |\n",
+			e.Repo, e.Number, escape.Replace(e.Author), escape.Replace(e.Title), e.Verdict, strings.Join(e.FailingRules, ", "), e.LabelCorrect)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
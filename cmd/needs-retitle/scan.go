@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/checkpoint"
+	"github.com/ouzi-dev/needs-retitle/pkg/config"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/pkg/flagutil"
+	"k8s.io/test-infra/prow/config/secret"
+	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	pluginsflagutil "k8s.io/test-infra/prow/flagutil/plugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+type scanOptions struct {
+	pluginConfig pluginsflagutil.PluginOptions
+	dryRun       bool
+	github       prowflagutil.GitHubOptions
+
+	scan   scanFlags
+	audit  auditFlags
+	output string
+}
+
+// scanFlags are the flags tuning how scans use the GitHub API.
+type scanFlags struct {
+	parallelism    int
+	minRateLimit   int
+	checkpointFile string
+	fullScanPeriod time.Duration
+}
+
+func (f *scanFlags) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&f.parallelism, "scan-parallelism", 1, "Number of PRs handled at the same time during scans.")
+	fs.IntVar(&f.minRateLimit, "scan-min-rate-limit", 0, "Number of GraphQL rate limit points under which scans pause until the rate limit resets.")
+	fs.StringVar(&f.checkpointFile, "checkpoint-file", "", "Path to the file recording the last scan. If set, scans only check the PRs updated since then and the ones that failed, running a full scan every --full-scan-period.")
+	fs.DurationVar(&f.fullScanPeriod, "full-scan-period", time.Hour*24*7, "Period duration for full scans of all PRs when scans are incremental.")
+}
+
+// run runs a periodic scan, incremental if there's a checkpoint file.
+func (f *scanFlags) run(log *logrus.Entry, p *plugin.Plugin, ghc github.Client, config *plugins.Configuration) error {
+	if len(f.checkpointFile) == 0 {
+		return p.HandleAll(log, ghc, config)
+	}
+	return p.HandlePeriodic(log, ghc, config, checkpoint.NewFileStore(f.checkpointFile), f.fullScanPeriod)
+}
+
+func (f *scanFlags) Options() plugin.ScanOptions {
+	return plugin.ScanOptions{
+		Parallelism:  f.parallelism,
+		MinRateLimit: f.minRateLimit,
+	}
+}
+
+type scanSummary struct {
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+	*plugin.ScanResult
+}
+
+// scan runs a single pass over all the open PRs in the orgs and repos that
+// enabled the plugin, so the periodic scan can run as a CronJob, then
+// follows up on the PRs that have carried the label for too long. It writes
+// a JSON summary and returns 1 if any PR couldn't be handled or the follow
+// up failed.
+func scan(args []string) int {
+	o := scanOptions{}
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s scan [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Only plans the changes to PRs, the plans are written in the summary.")
+	fs.StringVar(&o.output, "output", "", "Path to write the JSON summary to, stdout if empty.")
+	o.scan.AddFlags(fs)
+	o.audit.AddFlags(fs)
+	o.pluginConfig.PluginConfigPathDefault = "/etc/plugins/plugins.yaml"
+	for _, group := range []flagutil.OptionGroup{&o.github, &o.pluginConfig} {
+		group.AddFlags(fs)
+	}
+	fs.Parse(args)
+
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+	log := logrus.StandardLogger().WithField("plugin", plugin.PluginName)
+
+	if err := o.github.Validate(o.dryRun); err != nil {
+		log.WithError(err).Error("Invalid options.")
+		return 2
+	}
+
+	if err := secret.Add(o.github.TokenPath); err != nil {
+		log.WithError(err).Error("Error starting secrets agent.")
+		return 2
+	}
+
+	pa, err := o.pluginConfig.PluginAgent()
+	if err != nil {
+		log.WithError(err).Error("Error loading plugin config.")
+		return 2
+	}
+
+	pca := config.NewPluginConfigAgent()
+	if err := pca.Load(o.pluginConfig.PluginConfigPath); err != nil {
+		log.WithError(err).Errorf("Error loading %s config from %q.", plugin.PluginName, o.pluginConfig.PluginConfigPath)
+		return 2
+	}
+	pca.GetPlugin().SetScanOptions(o.scan.Options())
+	pca.GetPlugin().SetDryRun(o.dryRun)
+
+	sink, err := o.audit.open()
+	if err != nil {
+		log.WithError(err).Errorf("Error opening audit log %q.", o.audit.path)
+		return 2
+	}
+	if sink != nil {
+		defer func() {
+			if err := sink.Close(); err != nil {
+				log.WithError(err).Error("Error closing audit log.")
+			}
+		}()
+		pca.GetPlugin().SetAuditSink(sink)
+	}
+
+	githubClient, err := o.github.GitHubClient(o.dryRun)
+	if err != nil {
+		log.WithError(err).Error("Error getting GitHub client.")
+		return 2
+	}
+	githubClient.Throttle(360, 360)
+
+	start := time.Now()
+	var result *plugin.ScanResult
+	var store checkpoint.Store
+	if len(o.scan.checkpointFile) > 0 {
+		store = checkpoint.NewFileStore(o.scan.checkpointFile)
+		result, err = pca.GetPlugin().ScanPeriodic(log, githubClient, pa.Config(), store, o.scan.fullScanPeriod)
+	} else {
+		result, err = pca.GetPlugin().Scan(log, githubClient, pa.Config(), plugin.Scope{})
+	}
+	if err != nil {
+		log.WithError(err).Error("Error scanning PRs.")
+		return 2
+	}
+	log.WithField("duration", fmt.Sprintf("%v", time.Since(start))).Info("Scan complete.")
+
+	followUpErr := pca.GetPlugin().FollowUp(log, githubClient, pa.Config(), store)
+	if followUpErr != nil {
+		log.WithError(followUpErr).Error("Error following up on labelled PRs.")
+	}
+
+	out := os.Stdout
+	if len(o.output) > 0 {
+		if out, err = os.Create(o.output); err != nil {
+			log.WithError(err).Error("Error creating summary file.")
+			return 2
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(scanSummary{Start: start, Duration: time.Since(start).String(), ScanResult: result}); err != nil {
+		log.WithError(err).Error("Error writing summary.")
+		return 2
+	}
+
+	if err := result.Err(); err != nil {
+		log.WithError(err).Error("Some PRs couldn't be handled.")
+		return 1
+	}
+	if followUpErr != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/config"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"sigs.k8s.io/yaml"
+)
+
+// validateConfig strictly validates a plugins.yaml and prints the effective
+// rules for every org and repo that enabled the plugin. It returns 1 if the
+// file has any problems.
+func validateConfig(args []string) int {
+	var pluginConfig string
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate-config [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&pluginConfig, "plugin-config", "/etc/plugins/plugins.yaml", "Path to the plugin config file.")
+	fs.Parse(args)
+
+	pc, errs := config.ValidateFile(pluginConfig)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	pca := config.NewPluginConfigAgent()
+	if err := pca.Load(pluginConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", pluginConfig, err)
+		return 1
+	}
+
+	if pca.GetPlugin().GetConfig() == nil {
+		fmt.Fprintf(os.Stderr, "%s: no regular expression set, the %s plugin won't do anything\n", pluginConfig, plugin.PluginName)
+		return 0
+	}
+
+	orgs, repos := pc.EnabledReposForExternalPlugin(plugin.PluginName)
+	if len(orgs) == 0 && len(repos) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: no orgs or repos enable the %s external plugin\n", pluginConfig, plugin.PluginName)
+		return 0
+	}
+	enabled := append(orgs, repos...)
+	sort.Strings(enabled)
+
+	effective := map[string]*plugin.Rules{}
+	for _, key := range enabled {
+		org, repo := key, ""
+		if i := strings.Index(key, "/"); i >= 0 {
+			org, repo = key[:i], key[i+1:]
+		}
+		rules, err := pca.GetPlugin().RulesFor(org, repo, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", pluginConfig, key, err)
+			return 1
+		}
+		effective[key] = rules
+	}
+
+	b, err := yaml.Marshal(effective)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing effective rules: %v\n", err)
+		return 1
+	}
+	fmt.Print(string(b))
+	return 0
+}
@@ -0,0 +1,188 @@
+// Package audit records the changes the plugin makes to PRs.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is a change made to a PR, along with why it was made.
+type Record struct {
+	Time time.Time `json:"time"`
+	// EventGUID is the GUID of the webhook event the change was made for,
+	// or ScanID the ID of the scan.
+	EventGUID string `json:"event_guid,omitempty"`
+	ScanID    string `json:"scan_id,omitempty"`
+
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	// Action is the change made, Detail what it was made with, such as the
+	// label.
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+
+	Title      string        `json:"title,omitempty"`
+	Verdict    string        `json:"verdict,omitempty"`
+	Rules      []RuleVerdict `json:"rules,omitempty"`
+	ConfigHash string        `json:"config_hash,omitempty"`
+	// DryRun is set when the change was only planned, not made, and Shadow
+	// when that's because the repo is in shadow mode.
+	DryRun bool `json:"dry_run,omitempty"`
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// RuleVerdict is whether the title followed a rule, or whether the PR is
+// exempt from it as it was created before the rule took effect.
+type RuleVerdict struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Passed   bool   `json:"passed"`
+	Exempt   bool   `json:"exempt,omitempty"`
+}
+
+// Sink stores records.
+type Sink interface {
+	Write(r Record) error
+	Close() error
+}
+
+// FileSink appends records to a JSONL file. Once the file grows over
+// maxSize it's rotated to path.1, path.1 to path.2 and so on, keeping
+// maxBackups rotated files.
+type FileSink struct {
+	mut        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// NewFileSink opens the file at path for appending, creating it if needed.
+// A maxSize of 0 disables rotation.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// Write appends the record as a line, rotating the file first if the line
+// would take it over the maximum size.
+func (s *FileSink) Write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.f == nil {
+		return errors.New("audit log closed")
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(b)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotating the audit log: %w", err)
+		}
+	}
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	if s.maxBackups > 0 {
+		os.Remove(backup(s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backup(s.path, i), backup(s.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(s.path, backup(s.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func backup(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Read returns the records in the file at path and its rotated files,
+// oldest first, that match. Lines that can't be parsed are skipped.
+func Read(path string, match func(Record) bool) ([]Record, error) {
+	var paths []string
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup(path, i)); err != nil {
+			break
+		}
+		paths = append([]string{backup(path, i)}, paths...)
+	}
+	paths = append(paths, path)
+
+	var records []Record
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var r Record
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				continue
+			}
+			if match == nil || match(r) {
+				records = append(records, r)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	testCases := []struct {
+		name       string
+		maxSize    int64
+		maxBackups int
+
+		expectedNumbers []int
+		expectedFiles   []string
+	}{
+		{
+			name:            "no rotation",
+			expectedNumbers: []int{1, 2, 3, 4, 5},
+			expectedFiles:   []string{"audit.log"},
+		},
+		{
+			name:            "rotation keeps backups",
+			maxSize:         150,
+			maxBackups:      2,
+			expectedNumbers: []int{3, 4, 5},
+			expectedFiles:   []string{"audit.log", "audit.log.1", "audit.log.2"},
+		},
+		{
+			name:            "rotation without backups",
+			maxSize:         150,
+			expectedNumbers: []int{5},
+			expectedFiles:   []string{"audit.log"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.log")
+			s, err := NewFileSink(path, tc.maxSize, tc.maxBackups)
+			if !assert.NoError(t, err) {
+				return
+			}
+			// Each record is a line of a little over 100 bytes, so a
+			// maximum size of 150 rotates before every write.
+			for i := 1; i <= 5; i++ {
+				assert.NoError(t, s.Write(Record{Org: "org", Repo: "repo", Number: i, Action: "add_label", Detail: "needs-retitle"}))
+			}
+			assert.NoError(t, s.Close())
+			assert.Error(t, s.Write(Record{}))
+
+			records, err := Read(path, nil)
+			assert.NoError(t, err)
+			var numbers []int
+			for _, r := range records {
+				numbers = append(numbers, r.Number)
+			}
+			assert.Equal(t, tc.expectedNumbers, numbers)
+
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			var files []string
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+			assert.Equal(t, tc.expectedFiles, files)
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, os.WriteFile(path+".1", []byte(`{"org":"org","repo":"repo","number":1,"action":"add_label"}`+"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(path, []byte("not json\n"+`{"org":"org","repo":"other","number":1,"action":"add_label"}`+"\n"+`{"org":"org","repo":"repo","number":1,"action":"remove_label"}`+"\n"), 0o644))
+
+	records, err := Read(path, func(r Record) bool { return r.Repo == "repo" })
+	assert.NoError(t, err)
+	var actions []string
+	for _, r := range records {
+		actions = append(actions, r.Action)
+	}
+	assert.Equal(t, []string{"add_label", "remove_label"}, actions)
+
+	_, err = Read(filepath.Join(t.TempDir(), "missing.log"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records when the last scans started.
+type Checkpoint struct {
+	// LastScan is when the last successful scan, full or incremental,
+	// started.
+	LastScan time.Time `json:"last_scan"`
+	// LastFullScan is when the last successful full scan started.
+	LastFullScan time.Time `json:"last_full_scan"`
+	// Failed are the PRs the last scan couldn't handle, to check again in
+	// the next one.
+	Failed []PR `json:"failed,omitempty"`
+	// Notifications is what was announced to chat channels, so PRs aren't
+	// announced again within the window after a restart.
+	Notifications *Notifications `json:"notifications,omitempty"`
+}
+
+// PR identifies a PR.
+type PR struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+}
+
+// Notifications records the announcements made to chat channels.
+type Notifications struct {
+	// Announced is when each PR, as org/repo#number, was last announced to
+	// each channel, keyed by channel name.
+	Announced map[string]map[string]time.Time `json:"announced,omitempty"`
+	// LastDigest is when each channel last got a digest.
+	LastDigest map[string]time.Time `json:"last_digest,omitempty"`
+}
+
+// Store persists the checkpoint between restarts. Other backends, like a
+// ConfigMap, can be plugged in implementing it.
+type Store interface {
+	// Load returns the stored checkpoint, or an empty one if nothing was
+	// stored yet.
+	Load() (*Checkpoint, error)
+	// Save stores the checkpoint.
+	Save(*Checkpoint) error
+}
+
+// FileStore stores the checkpoint as JSON in a local file.
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the checkpoint from the file, it returns an empty checkpoint if
+// the file doesn't exist.
+func (s *FileStore) Load() (*Checkpoint, error) {
+	c := &Checkpoint{}
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the checkpoint to a temporary file and renames it, so the file
+// is never left half written.
+func (s *FileStore) Save(c *Checkpoint) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
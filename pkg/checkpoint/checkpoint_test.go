@@ -0,0 +1,26 @@
+package checkpoint
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	c, err := store.Load()
+	assert.NoError(t, err)
+	assert.True(t, c.LastScan.IsZero())
+	assert.True(t, c.LastFullScan.IsZero())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, store.Save(&Checkpoint{LastScan: now, LastFullScan: now.Add(-time.Hour)}))
+
+	c, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, now, c.LastScan)
+	assert.Equal(t, now.Add(-time.Hour), c.LastFullScan)
+}
@@ -1,11 +1,18 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
 	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
@@ -13,8 +20,19 @@ import (
 
 // ConfigAgent contains the agent mutex and the Agent configuration.
 type PluginConfigAgent struct {
-	configuration *Configuration
-	plugin        *plugin.Plugin
+	mut         sync.Mutex
+	snapshot    *Snapshot
+	lastErr     error
+	plugin      *plugin.Plugin
+	subscribers []func(prev, next *Snapshot)
+}
+
+// Snapshot is a loaded plugin config along with when it was loaded and its
+// hash. Snapshots are swapped as a whole and must not be modified.
+type Snapshot struct {
+	Configuration *Configuration
+	LoadTime      time.Time
+	Hash          string
 }
 
 // Configuration is the top-level serialization target for plugin Configuration.
@@ -25,6 +43,42 @@ type Configuration struct {
 type NeedsRetitle struct {
 	Regexp       string `json:"regexp"`
 	ErrorMessage string `json:"error_message"`
+	// Severity is the severity of the regexp rule: error (the default),
+	// warning or notice.
+	Severity string `json:"severity,omitempty"`
+	// EffectiveFrom is when the regexp rule takes effect, PRs created before
+	// then are exempt from it.
+	EffectiveFrom string `json:"effective_from,omitempty"`
+	// Rules are checked along with the regexp.
+	Rules []plugin.Rule `json:"rules,omitempty"`
+	// WarningLabel is added to PRs breaking warning rules, none if empty.
+	WarningLabel string `json:"warning_label,omitempty"`
+	// LockedFields are the fields the title policy files of repos can't
+	// override.
+	LockedFields []string `json:"locked_fields,omitempty"`
+	// Language is the language of the messages, English if empty.
+	Language string `json:"language,omitempty"`
+	// Languages overrides Language for orgs and org/repos.
+	Languages map[string]string `json:"languages,omitempty"`
+	// Messages are the message catalogues keyed by language.
+	Messages map[string]plugin.Catalogue `json:"messages,omitempty"`
+	// Examples are titles that follow the rules, shown in comments.
+	Examples []string `json:"examples,omitempty"`
+	// DocsURL is linked from comments, for example to a contribution guide.
+	DocsURL string `json:"docs_url,omitempty"`
+	// MentionAuthor is whether comments mention the author of the PR, true
+	// if unset.
+	MentionAuthor *bool `json:"mention_author,omitempty"`
+	// Notifications configures the chat channels PRs that have carried the
+	// label for too long are announced to.
+	Notifications notify.Config `json:"notifications,omitempty"`
+	// Escalation are the steps taken as PRs carry the label for longer.
+	Escalation []plugin.EscalationStep `json:"escalation,omitempty"`
+	// Mode is enforce (the default) to change PRs, or shadow to only
+	// evaluate them.
+	Mode string `json:"mode,omitempty"`
+	// Modes overrides Mode for orgs and org/repos.
+	Modes map[string]string `json:"modes,omitempty"`
 }
 
 func NewPluginConfigAgent() *PluginConfigAgent {
@@ -38,51 +92,183 @@ func (pca *PluginConfigAgent) GetPlugin() *plugin.Plugin {
 	return pca.plugin
 }
 
-// Start starts polling path for plugin config. If the first attempt fails,
-// then start returns the error. Future errors will halt updates but not stop.
+// Start loads the plugin config from path and reloads it whenever the
+// directory holding it changes. If the first attempt fails, then start
+// returns the error. Future errors keep the last good config in use.
 func (pca *PluginConfigAgent) Start(path string) error {
 	if err := pca.Load(path); err != nil {
 		return err
 	}
-	ticker := time.Tick(1 * time.Minute)
-	go func() {
-		for range ticker {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// Kubernetes updates mounted ConfigMaps by swapping a symlink in the
+	// directory, which doesn't show up as an event on the file itself.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go pca.watch(watcher, path)
+	return nil
+}
+
+func (pca *PluginConfigAgent) watch(watcher *fsnotify.Watcher, path string) {
+	defer watcher.Close()
+	log := logrus.WithField("path", path)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
 			if err := pca.Load(path); err != nil {
-				logrus.WithField("path", path).WithError(err).Error("Error loading plugin config.")
+				log.WithError(err).Error("Error reloading plugin config, keeping the last good one.")
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
 			}
+			log.WithError(err).Error("Error watching plugin config.")
 		}
-	}()
-	return nil
+	}
 }
 
 // Load attempts to load config from the path. It returns an error if either
-// the file can't be read or the configuration is invalid.
+// the file can't be read or the configuration is invalid, in which case the
+// current config is kept.
 func (pca *PluginConfigAgent) Load(path string) error {
-	b, err := ioutil.ReadFile(path)
+	np, err := load(path)
 	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		pca.mut.Lock()
+		pca.lastErr = err
+		pca.mut.Unlock()
 		return err
 	}
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+	pca.Set(np)
+	return nil
+}
+
+func load(path string) (*Configuration, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 	np := &Configuration{}
 	if err := yaml.Unmarshal(b, np); err != nil {
-		return err
+		return nil, err
 	}
-
 	if err := np.Validate(); err != nil {
-		return err
+		return nil, err
 	}
+	return np, nil
+}
 
-	pca.Set(np)
-	return nil
+// Snapshot returns the active config, it is nil until the first successful
+// load.
+func (pca *PluginConfigAgent) Snapshot() *Snapshot {
+	pca.mut.Lock()
+	defer pca.mut.Unlock()
+	return pca.snapshot
+}
+
+// LastLoad returns when the active config was loaded, it is zero until the
+// first successful load.
+func (pca *PluginConfigAgent) LastLoad() time.Time {
+	if s := pca.Snapshot(); s != nil {
+		return s.LoadTime
+	}
+	return time.Time{}
 }
 
-// Set sets the plugin agent configuration.
+// Hash returns the hash of the active config, it is empty until the first
+// successful load.
+func (pca *PluginConfigAgent) Hash() string {
+	if s := pca.Snapshot(); s != nil {
+		return s.Hash
+	}
+	return ""
+}
+
+// LastError returns the error of the last load, or nil if it succeeded.
+func (pca *PluginConfigAgent) LastError() error {
+	pca.mut.Lock()
+	defer pca.mut.Unlock()
+	return pca.lastErr
+}
+
+// Subscribe registers fn to be called with the previous and the new config
+// after a config replaces another one.
+func (pca *PluginConfigAgent) Subscribe(fn func(prev, next *Snapshot)) {
+	pca.mut.Lock()
+	defer pca.mut.Unlock()
+	pca.subscribers = append(pca.subscribers, fn)
+}
+
+// Set sets the plugin agent configuration. Setting a config with the same
+// hash as the active one only clears the last error.
 func (pca *PluginConfigAgent) Set(pc *Configuration) {
-	pca.configuration = pc
+	prev, next, subscribers := pca.swap(pc)
+	if prev == nil || next == nil {
+		return
+	}
+	for _, fn := range subscribers {
+		fn(prev, next)
+	}
+}
+
+// swap makes pc the active config. It returns the previous and the new
+// snapshots, the new one is nil if pc is the same as the active config.
+func (pca *PluginConfigAgent) swap(pc *Configuration) (*Snapshot, *Snapshot, []func(prev, next *Snapshot)) {
+	b, _ := json.Marshal(pc)
+	hash := fmt.Sprintf("%x", sha256.Sum256(b))
+
+	pca.mut.Lock()
+	defer pca.mut.Unlock()
+	pca.lastErr = nil
+	prev := pca.snapshot
+	if prev != nil && prev.Hash == hash {
+		return prev, nil, nil
+	}
+	pca.snapshot = &Snapshot{
+		Configuration: pc,
+		LoadTime:      time.Now(),
+		Hash:          hash,
+	}
 
 	if len(pc.NeedsRetitle.Regexp) > 0 {
-		r, _ := regexp.Compile(pca.configuration.NeedsRetitle.Regexp)
-		pca.plugin.SetConfig(pc.NeedsRetitle.ErrorMessage, r)
+		r, _ := regexp.Compile(pc.NeedsRetitle.Regexp)
+		pca.plugin.Configure(plugin.Settings{
+			Regexp:        r,
+			ErrorMessage:  pc.NeedsRetitle.ErrorMessage,
+			Severity:      pc.NeedsRetitle.Severity,
+			EffectiveFrom: pc.NeedsRetitle.EffectiveFrom,
+			Rules:         pc.NeedsRetitle.Rules,
+			WarningLabel:  pc.NeedsRetitle.WarningLabel,
+			LockedFields:  pc.NeedsRetitle.LockedFields,
+			Language:      pc.NeedsRetitle.Language,
+			Languages:     pc.NeedsRetitle.Languages,
+			Messages:      pc.NeedsRetitle.Messages,
+			Examples:      pc.NeedsRetitle.Examples,
+			DocsURL:       pc.NeedsRetitle.DocsURL,
+			MentionAuthor: pc.NeedsRetitle.MentionAuthor,
+			Notifications: pc.NeedsRetitle.Notifications,
+			Escalation:    pc.NeedsRetitle.Escalation,
+			Mode:          pc.NeedsRetitle.Mode,
+			Modes:         pc.NeedsRetitle.Modes,
+			ConfigHash:    hash,
+		})
 	}
+
+	metrics.ConfigLoadTime.Set(float64(pca.snapshot.LoadTime.Unix()))
+	metrics.ConfigInfo.Reset()
+	metrics.ConfigInfo.WithLabelValues(hash).Set(1)
+	return prev, pca.snapshot, pca.subscribers
 }
 
 func (c *Configuration) Validate() error {
@@ -91,11 +277,8 @@ func (c *Configuration) Validate() error {
 		return nil
 	}
 
-	_, err := regexp.Compile(c.NeedsRetitle.Regexp)
-
-	if err != nil {
-		return fmt.Errorf("error compiling regular expression %s: %v", c.NeedsRetitle.Regexp, err)
+	if errs := c.NeedsRetitle.validate(); len(errs) > 0 {
+		return errs[0]
 	}
-
 	return nil
 }
@@ -1,18 +1,26 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestConfigValidate(t *testing.T) {
 	pca := NewPluginConfigAgent()
 
+	assert.True(t, pca.LastLoad().IsZero())
+
 	err := pca.Load("test/noconfig.yaml")
 
 	assert.NoError(t, err)
 
+	assert.False(t, pca.LastLoad().IsZero())
+
 	assert.Nil(t, pca.plugin.GetConfig())
 
 	err = pca.Load("test/wrongconfig.yaml")
@@ -27,3 +35,122 @@ func TestConfigValidate(t *testing.T) {
 
 	assert.NotNil(t, pca.plugin.GetConfig())
 }
+
+func TestLastKnownGood(t *testing.T) {
+	pca := NewPluginConfigAgent()
+
+	assert.NoError(t, pca.Load("test/config.yaml"))
+	snapshot := pca.Snapshot()
+	assert.NotEmpty(t, pca.Hash())
+	assert.NoError(t, pca.LastError())
+
+	assert.Error(t, pca.Load("test/wrongconfig.yaml"))
+	assert.Same(t, snapshot, pca.Snapshot())
+	assert.Error(t, pca.LastError())
+	rules, err := pca.plugin.RulesFor("org", "repo", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "^(fix:|feat:|major:).*$", rules.Regexp)
+
+	// Reloading the same config keeps the snapshot and clears the error.
+	assert.NoError(t, pca.Load("test/config.yaml"))
+	assert.Same(t, snapshot, pca.Snapshot())
+	assert.NoError(t, pca.LastError())
+}
+
+func TestStartReloadsOnSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name, "plugins.yaml"), []byte(content), 0644))
+	}
+	// Mimic how Kubernetes mounts ConfigMaps: the file is a symlink through
+	// a "..data" symlink that is swapped on updates.
+	write("..v1", "needs_retitle:\n  regexp: \"^fix:.*$\"\n")
+	assert.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "plugins.yaml"), filepath.Join(dir, "plugins.yaml")))
+
+	pca := NewPluginConfigAgent()
+	assert.NoError(t, pca.Start(filepath.Join(dir, "plugins.yaml")))
+	hash := pca.Hash()
+
+	write("..v2", "needs_retitle:\n  regexp: \"^feat:.*$\"\n")
+	assert.NoError(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	assert.Eventually(t, func() bool {
+		return pca.Hash() != hash
+	}, 5*time.Second, 10*time.Millisecond)
+	rules, err := pca.plugin.RulesFor("org", "repo", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "^feat:.*$", rules.Regexp)
+}
+
+func TestChangedRules(t *testing.T) {
+	orgs := []string{"org"}
+	repos := []string{"org/repo", "other/repo"}
+	prev := &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$"}}
+
+	testCases := []struct {
+		name string
+		next *Configuration
+
+		expected []string
+	}{
+		{
+			name: "same rules",
+			next: &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$"}},
+		},
+		{
+			name:     "changed rules",
+			next:     &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^feat:.*$"}},
+			expected: []string{"org", "other/repo"},
+		},
+		{
+			name: "explicit default mode",
+			next: &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Mode: "enforce"}},
+		},
+		{
+			name:     "repo switched to shadow mode",
+			next:     &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Modes: map[string]string{"other/repo": "shadow", "third": "shadow"}}},
+			expected: []string{"other/repo"},
+		},
+		{
+			name:     "repo switched to another language",
+			next:     &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Languages: map[string]string{"other/repo": "de"}}},
+			expected: []string{"other/repo"},
+		},
+		{
+			name: "messages changed for a language not in use",
+			next: &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Languages: map[string]string{"third": "de"}, Messages: map[string]plugin.Catalogue{"de": {ErrorMessage: "Falscher Titel."}}}},
+		},
+		{
+			name:     "messages changed for the language of a repo",
+			next:     &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Messages: map[string]plugin.Catalogue{"en": {ErrorMessage: "Wrong title."}}}},
+			expected: []string{"org", "other/repo"},
+		},
+		{
+			name:     "repo of an enabled org switched to shadow mode",
+			next:     &Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Modes: map[string]string{"org/repo": "shadow"}}},
+			expected: []string{"org"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ChangedRules(prev, tc.next, orgs, repos))
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	pca := NewPluginConfigAgent()
+	var calls []string
+	pca.Subscribe(func(prev, next *Snapshot) {
+		calls = append(calls, prev.Configuration.NeedsRetitle.Regexp+" -> "+next.Configuration.NeedsRetitle.Regexp)
+	})
+
+	pca.Set(&Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$"}})
+	pca.Set(&Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^fix:.*$"}})
+	pca.Set(&Configuration{NeedsRetitle: NeedsRetitle{Regexp: "^feat:.*$"}})
+	assert.Equal(t, []string{"^fix:.*$ -> ^feat:.*$"}, calls)
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+)
+
+// rulesFor returns the effective rules for org/repo, or for the whole org if
+// repo is empty. Notifications and escalation don't change how titles are
+// checked, so they're left out. The mode and the language are resolved for
+// the org or the repo, and only the message catalogues of the languages in
+// use are kept, so switching a repo to enforce or changing the messages of a
+// language only rescans the repos using it. The modes and languages of the
+// repos of an org are kept for the whole org, as its repos aren't compared
+// one by one.
+func (c *Configuration) rulesFor(org, repo string) NeedsRetitle {
+	rules := c.NeedsRetitle
+	rules.Notifications = notify.Config{}
+	rules.Escalation = nil
+	settings := plugin.Settings{Mode: rules.Mode, Modes: rules.Modes, Language: rules.Language, Languages: rules.Languages}
+	rules.Mode = settings.ModeFor(org, repo)
+	rules.Language = settings.LanguageFor(org, repo)
+	rules.Modes, rules.Languages = nil, nil
+	if len(repo) == 0 {
+		rules.Modes = orgRepos(settings.Modes, org)
+		rules.Languages = orgRepos(settings.Languages, org)
+	}
+
+	languages := []string{rules.Language}
+	for _, language := range rules.Languages {
+		languages = append(languages, language)
+	}
+	messages := rules.Messages
+	rules.Messages = nil
+	for _, language := range languages {
+		if catalogue, ok := messages[language]; ok {
+			if rules.Messages == nil {
+				rules.Messages = map[string]plugin.Catalogue{}
+			}
+			rules.Messages[language] = catalogue
+		}
+	}
+	return rules
+}
+
+// orgRepos returns the values of m set for the repos of org, nil if none is.
+func orgRepos(m map[string]string, org string) map[string]string {
+	var repos map[string]string
+	for key, value := range m {
+		if strings.HasPrefix(key, org+"/") {
+			if repos == nil {
+				repos = map[string]string{}
+			}
+			repos[key] = value
+		}
+	}
+	return repos
+}
+
+// ChangedRules returns the orgs and org/repos, out of orgs and repos, whose
+// effective rules differ between the previous and next config. Repos are left out
+// when their org is already returned.
+func ChangedRules(prev, next *Configuration, orgs, repos []string) []string {
+	var changed []string
+	changedOrgs := map[string]bool{}
+	for _, org := range orgs {
+		if !reflect.DeepEqual(prev.rulesFor(org, ""), next.rulesFor(org, "")) {
+			changed = append(changed, org)
+			changedOrgs[org] = true
+		}
+	}
+	for _, repo := range repos {
+		parts := strings.SplitN(repo, "/", 2)
+		if len(parts) != 2 || changedOrgs[parts[0]] {
+			continue
+		}
+		if !reflect.DeepEqual(prev.rulesFor(parts[0], parts[1]), next.rulesFor(parts[0], parts[1])) {
+			changed = append(changed, repo)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,409 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"gopkg.in/yaml.v3"
+	"k8s.io/test-infra/prow/plugins"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+var (
+	unknownFieldRe = regexp.MustCompile(`unknown field "([^"]+)"`)
+	yamlLineRe     = regexp.MustCompile(`line (\d+): `)
+)
+
+// ValidationError is a problem found in a config file, pointing to the line
+// where it was found when possible.
+type ValidationError struct {
+	File string
+	Line int
+	Path string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+	}
+	if len(e.Path) > 0 {
+		return fmt.Sprintf("%s: %s: %v", location, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", location, e.Err)
+}
+
+// pluginsFile is the full content of a plugins.yaml file, the prow plugins
+// configuration along with the configuration of this plugin.
+type pluginsFile struct {
+	plugins.Configuration `json:",inline"`
+	NeedsRetitle          NeedsRetitle `json:"needs_retitle"`
+}
+
+// ValidateFile strictly parses a plugins.yaml file, rejecting unknown
+// fields, and validates the rules of this plugin and the org and repo keys.
+// It returns the parsed prow plugins configuration along with all the
+// problems found.
+func ValidateFile(path string) (*plugins.Configuration, []error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, []error{yamlError(path, err)}
+	}
+
+	pf := &pluginsFile{}
+	if err := sigsyaml.UnmarshalStrict(b, pf); err != nil {
+		if m := unknownFieldRe.FindStringSubmatch(err.Error()); m != nil {
+			// The decoder stops at the first unknown field, so they're all
+			// looked up in the nodes.
+			if errs := unknownFields(path, &root, reflect.TypeOf(pf), nil); len(errs) > 0 {
+				return nil, errs
+			}
+			return nil, []error{&ValidationError{File: path, Line: findKey(&root, m[1]), Path: m[1], Err: fmt.Errorf("unknown field")}}
+		}
+		return nil, []error{yamlError(path, err)}
+	}
+
+	var errs []error
+	add := func(err error, keys ...string) {
+		errs = append(errs, &ValidationError{File: path, Line: lineOf(&root, keys...), Path: strings.Join(keys, "."), Err: err})
+	}
+
+	for _, fe := range pf.NeedsRetitle.validate() {
+		keys := append([]string{"needs_retitle"}, fe.keys...)
+		line := lineOf(&root, append(keys, fe.entry...)...)
+		errs = append(errs, &ValidationError{File: path, Line: line, Path: strings.Join(keys, "."), Err: fe.err})
+	}
+
+	externalPluginKeys := make([]string, 0, len(pf.ExternalPlugins))
+	for key := range pf.ExternalPlugins {
+		externalPluginKeys = append(externalPluginKeys, key)
+	}
+	sort.Strings(externalPluginKeys)
+	for _, key := range externalPluginKeys {
+		if err := validateRepoKey(key); err != nil {
+			add(err, "external_plugins", key)
+		}
+	}
+	pluginKeys := make([]string, 0, len(pf.Plugins))
+	for key := range pf.Plugins {
+		pluginKeys = append(pluginKeys, key)
+	}
+	sort.Strings(pluginKeys)
+	for _, key := range pluginKeys {
+		if err := validateRepoKey(key); err != nil {
+			add(err, "plugins", key)
+		}
+	}
+
+	return &pf.Configuration, errs
+}
+
+// fieldError is a problem found in the config of the plugin, in the field
+// at the path of keys under needs_retitle. entry is the path under the field
+// of the entry with the problem, if any.
+type fieldError struct {
+	keys  []string
+	entry []string
+	err   error
+}
+
+func (e fieldError) Error() string {
+	return fmt.Sprintf("%s: %v", strings.Join(e.keys, "."), e.err)
+}
+
+// validate returns all the problems found in the config of the plugin. An
+// empty regular expression isn't one, it disables the plugin, so nothing
+// else is checked.
+func (nr NeedsRetitle) validate() []fieldError {
+	if len(nr.Regexp) == 0 {
+		return nil
+	}
+	var errs []fieldError
+	add := func(err error, keys ...string) {
+		errs = append(errs, fieldError{keys: keys, err: err})
+	}
+
+	var re *regexp.Regexp
+	if len(nr.Regexp) > 0 {
+		var err error
+		if re, err = regexp.Compile(nr.Regexp); err != nil {
+			add(err, "regexp")
+		}
+	}
+	if err := plugin.ValidateMessage(nr.ErrorMessage); err != nil {
+		add(err, "error_message")
+	}
+	if err := plugin.ValidateSeverity(nr.Severity); err != nil {
+		add(err, "severity")
+	}
+	if _, err := plugin.ParseEffectiveFrom(nr.EffectiveFrom); err != nil {
+		add(err, "effective_from")
+	}
+	var ruleErr *plugin.RuleError
+	if err := plugin.ValidateRules(nr.Rules); errors.As(err, &ruleErr) {
+		errs = append(errs, fieldError{keys: []string{"rules"}, entry: []string{strconv.Itoa(ruleErr.Index)}, err: err})
+	} else if err != nil {
+		add(err, "rules")
+	} else if re != nil {
+		if err := plugin.ValidateExamples(re, nr.Rules, nr.Examples); err != nil {
+			add(err, "examples")
+		}
+	}
+	if err := validateLockedFields(nr.LockedFields); err != nil {
+		add(err, "locked_fields")
+	}
+	errs = append(errs, validateLanguages(nr)...)
+	if err := nr.Notifications.Validate(); err != nil {
+		add(err, "notifications")
+	}
+	if err := plugin.ValidateEscalation(nr.Escalation); err != nil {
+		add(err, "escalation")
+	}
+	return append(errs, validateModes(nr)...)
+}
+
+// validateLockedFields checks the fields can be locked.
+func validateLockedFields(fields []string) error {
+	for _, field := range fields {
+		lockable := false
+		for _, f := range plugin.LockableFields {
+			lockable = lockable || f == field
+		}
+		if !lockable {
+			return fmt.Errorf("%q can't be locked, lockable fields are %s", field, strings.Join(plugin.LockableFields, ", "))
+		}
+	}
+	return nil
+}
+
+// validateLanguages checks there are messages for the languages, set for
+// orgs and org/repos, and the catalogues are valid.
+func validateLanguages(nr NeedsRetitle) []fieldError {
+	var errs []fieldError
+	if err := plugin.ValidateLanguage(nr.Language, nr.Messages); err != nil {
+		errs = append(errs, fieldError{keys: []string{"language"}, err: err})
+	}
+	for _, key := range sortedKeys(nr.Languages) {
+		if err := validateRepoKey(key); err != nil {
+			errs = append(errs, fieldError{keys: []string{"languages", key}, err: err})
+		} else if err := plugin.ValidateLanguage(nr.Languages[key], nr.Messages); err != nil {
+			errs = append(errs, fieldError{keys: []string{"languages", key}, err: err})
+		}
+	}
+	if err := plugin.ValidateCatalogues(nr.Messages); err != nil {
+		errs = append(errs, fieldError{keys: []string{"messages"}, err: err})
+	}
+	return errs
+}
+
+// validateModes checks the modes are valid and set for orgs and org/repos.
+func validateModes(nr NeedsRetitle) []fieldError {
+	var errs []fieldError
+	if err := plugin.ValidateMode(nr.Mode); err != nil {
+		errs = append(errs, fieldError{keys: []string{"mode"}, err: err})
+	}
+	for _, key := range sortedKeys(nr.Modes) {
+		if err := validateRepoKey(key); err != nil {
+			errs = append(errs, fieldError{keys: []string{"modes", key}, err: err})
+		} else if err := plugin.ValidateMode(nr.Modes[key]); err != nil {
+			errs = append(errs, fieldError{keys: []string{"modes", key}, err: err})
+		}
+	}
+	return errs
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateRepoKey checks the key is either an org or an org/repo.
+func validateRepoKey(key string) error {
+	parts := strings.Split(key, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("%q is neither an org nor an org/repo", key)
+	}
+	for _, part := range parts {
+		if len(part) == 0 {
+			return fmt.Errorf("%q is neither an org nor an org/repo", key)
+		}
+	}
+	return nil
+}
+
+// yamlError converts a YAML parsing error into a ValidationError, taking the
+// line from the error message if it has one.
+func yamlError(path string, err error) error {
+	ve := &ValidationError{File: path, Err: err}
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		ve.Line, _ = strconv.Atoi(m[1])
+	}
+	return ve
+}
+
+// lineOf returns the line of the node for the path of mapping keys and
+// sequence indexes, or the line of the deepest one found.
+func lineOf(root *yaml.Node, keys ...string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := 0
+	for _, key := range keys {
+		if node.Kind == yaml.SequenceNode {
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+			continue
+		}
+		if node.Kind != yaml.MappingNode {
+			return line
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return line
+		}
+	}
+	return line
+}
+
+// findKey returns the line of the first mapping key with the name, or 0 if
+// there is none.
+func findKey(node *yaml.Node, name string) int {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				return node.Content[i].Line
+			}
+		}
+	}
+	for _, child := range node.Content {
+		if line := findKey(child, name); line > 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields returns the mapping keys in node of file, at the path of
+// keys, that don't match a field of t the way encoding/json matches them.
+// Types that unmarshal themselves aren't looked into.
+func unknownFields(file string, node *yaml.Node, t reflect.Type, keys []string) []error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return unknownFields(file, node.Content[0], t, keys)
+	}
+
+	var errs []error
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := jsonFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldKeys := append(append([]string{}, keys...), key.Value)
+			ft, ok := fieldType(fields, key.Value)
+			if !ok {
+				errs = append(errs, &ValidationError{File: file, Line: key.Line, Path: strings.Join(fieldKeys, "."), Err: fmt.Errorf("unknown field")})
+				continue
+			}
+			errs = append(errs, unknownFields(file, node.Content[i+1], ft, fieldKeys)...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, unknownFields(file, node.Content[i+1], t.Elem(), append(append([]string{}, keys...), node.Content[i].Value))...)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			errs = append(errs, unknownFields(file, item, t.Elem(), append(append([]string{}, keys...), strconv.Itoa(i)))...)
+		}
+	}
+	return errs
+}
+
+// jsonFields returns the types of the fields of the struct type by their
+// JSON names, including the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+			for n, t := range jsonFields(ft) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = t
+				}
+			}
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// fieldType returns the type of the field matching the key, preferring an
+// exact match over a case-insensitive one, like encoding/json.
+func fieldType(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		path string
+
+		expectedErrs []string
+	}{
+		{
+			name: "valid config",
+			path: "test/validconfig.yaml",
+		},
+		{
+			name: "unknown field",
+			path: "test/unknownfield.yaml",
+			expectedErrs: []string{
+				"test/unknownfield.yaml:4: external_plugins.org-foo.0.endpont: unknown field",
+				"test/unknownfield.yaml:7: needs_retitle.error_mesage: unknown field",
+				"test/unknownfield.yaml:10: needs_retitle.rules.0.regex: unknown field",
+			},
+		},
+		{
+			name: "no regexp disables the plugin",
+			path: "test/noregexp.yaml",
+		},
+		{
+			name: "invalid regexp and repo key",
+			path: "test/invalidconfig.yaml",
+			expectedErrs: []string{
+				"test/invalidconfig.yaml:5: needs_retitle.regexp: error parsing regexp: invalid or unsupported Perl syntax: `(?'`",
+				`test/invalidconfig.yaml:2: external_plugins.org-foo/repo-bar/blah: "org-foo/repo-bar/blah" is neither an org nor an org/repo`,
+			},
+		},
+		{
+			name:         "field that can't be locked",
+			path:         "test/lockedfields.yaml",
+			expectedErrs: []string{`test/lockedfields.yaml:6: needs_retitle.locked_fields: "title" can't be locked, lockable fields are regexp, error_message, severity, effective_from, rules, warning_label, examples, docs_url, escalation`},
+		},
+		{
+			name: "invalid severity and rules",
+			path: "test/rules.yaml",
+			expectedErrs: []string{
+				`test/rules.yaml:6: needs_retitle.severity: invalid severity "fatal", valid severities are error, warning, notice`,
+				`test/rules.yaml:12: needs_retitle.rules: rule 1: duplicate name "length"`,
+			},
+		},
+		{
+			name: "invalid effective dates",
+			path: "test/effectivefrom.yaml",
+			expectedErrs: []string{
+				`test/effectivefrom.yaml:6: needs_retitle.effective_from: invalid date "01/06/2024", use a date like 2006-01-02 or an RFC 3339 time`,
+				`test/effectivefrom.yaml:8: needs_retitle.rules: rule "length": effective_from: invalid date "2024-06-01T00:00:00", use a date like 2006-01-02 or an RFC 3339 time`,
+			},
+		},
+		{
+			name: "invalid languages and messages",
+			path: "test/languages.yaml",
+			expectedErrs: []string{
+				`test/languages.yaml:6: needs_retitle.language: no messages for language "fr", built-in languages are de, en, ja`,
+				`test/languages.yaml:9: needs_retitle.languages.org-foo/bar/baz: "org-foo/bar/baz" is neither an org nor an org/repo`,
+				`test/languages.yaml:10: needs_retitle.messages: de.error_message: template: message:1:23: executing "message" at <.Autor>: can't evaluate field Autor in type plugin.messageData`,
+			},
+		},
+		{
+			name:         "example breaking the rules",
+			path:         "test/examples.yaml",
+			expectedErrs: []string{`test/examples.yaml:6: needs_retitle.examples: example "Add a feature" breaks the "regexp" rule`},
+		},
+		{
+			name: "invalid notifications and escalation",
+			path: "test/notifications.yaml",
+			expectedErrs: []string{
+				`test/notifications.yaml:6: needs_retitle.notifications: channel "team-foo": invalid format "teams", valid formats are slack, mattermost`,
+				`test/notifications.yaml:14: needs_retitle.escalation: step 1: after must be longer than the previous step`,
+			},
+		},
+		{
+			name: "invalid modes",
+			path: "test/modes.yaml",
+			expectedErrs: []string{
+				`test/modes.yaml:6: needs_retitle.mode: invalid mode "observe", valid modes are enforce, shadow`,
+				`test/modes.yaml:9: needs_retitle.modes.org-foo/bar: invalid mode "loud", valid modes are enforce, shadow`,
+			},
+		},
+		{
+			name:         "missing file",
+			path:         "test/missing.yaml",
+			expectedErrs: []string{"open test/missing.yaml: no such file or directory"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, errs := ValidateFile(tc.path)
+			var actual []string
+			for _, err := range errs {
+				actual = append(actual, err.Error())
+			}
+			assert.Equal(t, tc.expectedErrs, actual)
+		})
+	}
+}
+
+func TestConfigurationValidate(t *testing.T) {
+	testCases := []struct {
+		name         string
+		needsRetitle NeedsRetitle
+
+		expectedErr string
+	}{
+		{
+			name:         "no regexp disables the plugin",
+			needsRetitle: NeedsRetitle{Mode: "observe"},
+		},
+		{
+			name:         "valid",
+			needsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Modes: map[string]string{"org": "shadow"}},
+		},
+		{
+			name:         "invalid mode key",
+			needsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Modes: map[string]string{"org/repo": "shadow", "org/repo/x": "shadow"}},
+			expectedErr:  `modes.org/repo/x: "org/repo/x" is neither an org nor an org/repo`,
+		},
+		{
+			name:         "first problem is returned",
+			needsRetitle: NeedsRetitle{Regexp: "^fix:.*$", Severity: "fatal", Language: "fr"},
+			expectedErr:  `severity: invalid severity "fatal", valid severities are error, warning, notice`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Configuration{NeedsRetitle: tc.needsRetitle}
+			err := c.Validate()
+			if len(tc.expectedErr) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "needs_retitle"
+
+var (
+	// WebhookEvents counts the webhook events received by type and action.
+	WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Number of webhook events received by event type and action.",
+	}, []string{"event_type", "action"})
+
+	// Evaluations counts the title evaluations by verdict and repo.
+	Evaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evaluations_total",
+		Help:      "Number of PR title evaluations by verdict and repo.",
+	}, []string{"verdict", "repo"})
+
+	// Labels counts the labels added and removed by the plugin.
+	Labels = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "labels_total",
+		Help:      "Number of labels added or removed.",
+	}, []string{"operation"})
+
+	// Comments counts the comments created and deleted by the plugin.
+	Comments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_total",
+		Help:      "Number of comments created or deleted.",
+	}, []string{"operation"})
+
+	// GitHubErrors counts the failed GitHub API calls by operation.
+	GitHubErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_errors_total",
+		Help:      "Number of failed GitHub API calls by operation.",
+	}, []string{"operation"})
+
+	// Notifications counts the notifications posted to chat channels by kind
+	// (alert or digest) and result.
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Number of notifications posted by kind and result.",
+	}, []string{"kind", "result"})
+
+	// Escalations counts the escalation steps taken by action.
+	Escalations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "escalations_total",
+		Help:      "Number of escalation steps taken by action.",
+	}, []string{"action"})
+
+	// ShadowActions counts the actions that would have been taken on PRs
+	// in repos in shadow mode, by repo and action.
+	ShadowActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_actions_total",
+		Help:      "Number of actions that would have been taken on PRs in repos in shadow mode by repo and action.",
+	}, []string{"repo", "action"})
+
+	// HandleAllDuration observes how long a periodic pass over all PRs takes.
+	HandleAllDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handle_all_duration_seconds",
+		Help:      "Duration of a pass over all open PRs.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	})
+
+	// HandlerLatency observes how long handling a single webhook event takes.
+	HandlerLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_latency_seconds",
+		Help:      "Latency of webhook event handlers by event type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event_type"})
+
+	// LabelledPRs tracks the open PRs carrying the needs-retitle label per repo.
+	LabelledPRs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "labelled_prs",
+		Help:      "Number of open PRs currently carrying the needs-retitle label per repo.",
+	}, []string{"repo"})
+
+	// ConfigReloads counts plugin config loads by result: success or failure.
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Number of plugin config loads by result.",
+	}, []string{"result"})
+
+	// ConfigLoadTime tracks when the active plugin config was loaded.
+	ConfigLoadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_load_timestamp_seconds",
+		Help:      "Unix time the active plugin config was loaded.",
+	})
+
+	// ConfigInfo is set to 1 for the hash of the active plugin config.
+	ConfigInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_info",
+		Help:      "Hash of the active plugin config.",
+	}, []string{"hash"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		WebhookEvents,
+		Evaluations,
+		Labels,
+		Comments,
+		GitHubErrors,
+		HandleAllDuration,
+		HandlerLatency,
+		LabelledPRs,
+		ConfigReloads,
+		ConfigLoadTime,
+		ConfigInfo,
+		Notifications,
+		Escalations,
+		ShadowActions,
+	)
+}
@@ -0,0 +1,333 @@
+// Package notify announces PRs that have carried the "needs-retitle" label
+// for too long to chat channels through incoming webhooks.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/checkpoint"
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatSlack and FormatMattermost are the supported webhook formats.
+	FormatSlack      = "slack"
+	FormatMattermost = "mattermost"
+
+	defaultMinAge = 72 * time.Hour
+	defaultWindow = 24 * time.Hour
+
+	// digestPeriod is how often each channel gets a digest.
+	digestPeriod = 24 * time.Hour
+)
+
+// Config configures the notifications.
+type Config struct {
+	// MinAge is how long PRs carry the label before they're announced, 72h
+	// if empty.
+	MinAge string `json:"min_age,omitempty"`
+	// Window is how long announced PRs aren't announced again, 24h if empty.
+	Window string `json:"window,omitempty"`
+	// Channels are where PRs are announced.
+	Channels []Channel `json:"channels,omitempty"`
+}
+
+// Channel is an incoming webhook PRs in some orgs and repos are announced to.
+type Channel struct {
+	Name string `json:"name"`
+	// WebhookURL is the URL of the incoming webhook, or WebhookURLFile the
+	// path of a file holding it.
+	WebhookURL     string `json:"webhook_url,omitempty"`
+	WebhookURLFile string `json:"webhook_url_file,omitempty"`
+	// Format is slack, the default, or mattermost.
+	Format string `json:"format,omitempty"`
+	// Repos are the orgs and org/repos whose PRs are announced.
+	Repos []string `json:"repos"`
+}
+
+// Validate checks the durations parse and every channel has a name, a
+// webhook, a known format and repos.
+func (c Config) Validate() error {
+	if _, _, err := c.durations(); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, ch := range c.Channels {
+		if len(ch.Name) == 0 {
+			return fmt.Errorf("channel %d: a name is required", i)
+		}
+		if names[ch.Name] {
+			return fmt.Errorf("channel %d: duplicate name %q", i, ch.Name)
+		}
+		names[ch.Name] = true
+		if (len(ch.WebhookURL) == 0) == (len(ch.WebhookURLFile) == 0) {
+			return fmt.Errorf("channel %q: exactly one of webhook_url and webhook_url_file is required", ch.Name)
+		}
+		if ch.Format != "" && ch.Format != FormatSlack && ch.Format != FormatMattermost {
+			return fmt.Errorf("channel %q: invalid format %q, valid formats are %s, %s", ch.Name, ch.Format, FormatSlack, FormatMattermost)
+		}
+		if len(ch.Repos) == 0 {
+			return fmt.Errorf("channel %q: at least one org or repo is required", ch.Name)
+		}
+	}
+	return nil
+}
+
+func (c Config) durations() (time.Duration, time.Duration, error) {
+	minAge, window := defaultMinAge, defaultWindow
+	var err error
+	if len(c.MinAge) > 0 {
+		if minAge, err = time.ParseDuration(c.MinAge); err != nil {
+			return 0, 0, fmt.Errorf("min_age: %v", err)
+		}
+	}
+	if len(c.Window) > 0 {
+		if window, err = time.ParseDuration(c.Window); err != nil {
+			return 0, 0, fmt.Errorf("window: %v", err)
+		}
+	}
+	return minAge, window, nil
+}
+
+// PR is a PR carrying the "needs-retitle" label.
+type PR struct {
+	Org    string
+	Repo   string
+	Number int
+	Title  string
+	Author string
+	URL    string
+	// Since is when the label was added.
+	Since time.Time
+}
+
+// announcement is a PR announced to a channel.
+type announcement struct {
+	channel string
+	pr      string
+}
+
+func (pr PR) key() string {
+	return fmt.Sprintf("%s/%s#%d", pr.Org, pr.Repo, pr.Number)
+}
+
+// Notifier posts the PRs that have carried the label for longer than the
+// minimum age to the channels of their repos. Each PR is announced once per
+// window, and each channel gets a digest of all of them once a day.
+type Notifier struct {
+	mut    sync.Mutex
+	config Config
+	client *http.Client
+	now    func() time.Time
+	// announced is when each PR was last announced to each channel.
+	announced map[announcement]time.Time
+	// lastDigest is when each channel last got a digest.
+	lastDigest map[string]time.Time
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		now:        time.Now,
+		announced:  map[announcement]time.Time{},
+		lastDigest: map[string]time.Time{},
+	}
+}
+
+// Configure replaces the config, the PRs already announced are kept.
+func (n *Notifier) Configure(c Config) {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	n.config = c
+}
+
+// State returns what was announced, to be persisted.
+func (n *Notifier) State() *checkpoint.Notifications {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	s := &checkpoint.Notifications{
+		Announced:  map[string]map[string]time.Time{},
+		LastDigest: map[string]time.Time{},
+	}
+	for a, at := range n.announced {
+		if s.Announced[a.channel] == nil {
+			s.Announced[a.channel] = map[string]time.Time{}
+		}
+		s.Announced[a.channel][a.pr] = at
+	}
+	for channel, at := range n.lastDigest {
+		s.LastDigest[channel] = at
+	}
+	return s
+}
+
+// Restore replaces what was announced with the persisted state, nil leaves
+// it as it is.
+func (n *Notifier) Restore(s *checkpoint.Notifications) {
+	if s == nil {
+		return
+	}
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	n.announced = map[announcement]time.Time{}
+	for channel, prs := range s.Announced {
+		for pr, at := range prs {
+			n.announced[announcement{channel, pr}] = at
+		}
+	}
+	n.lastDigest = map[string]time.Time{}
+	for channel, at := range s.LastDigest {
+		n.lastDigest[channel] = at
+	}
+}
+
+// Enabled returns true if there are channels to notify.
+func (n *Notifier) Enabled() bool {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	return len(n.config.Channels) > 0
+}
+
+// Notify announces the PRs that have carried the label for longer than the
+// minimum age. prs are all the PRs carrying the label, the ones not in it
+// are forgotten. With dryRun the announcements are only logged, and nothing
+// is recorded as announced. It returns the last error posting to a channel.
+func (n *Notifier) Notify(log *logrus.Entry, prs []PR, dryRun bool) error {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	minAge, window, err := n.config.durations()
+	if err != nil {
+		return err
+	}
+	now := n.now()
+
+	labelled := map[string]bool{}
+	for _, pr := range prs {
+		labelled[pr.key()] = true
+	}
+	if !dryRun {
+		for a, at := range n.announced {
+			if !labelled[a.pr] || now.Sub(at) >= window {
+				delete(n.announced, a)
+			}
+		}
+	}
+
+	var lastErr error
+	for _, ch := range n.config.Channels {
+		var overdue []PR
+		for _, pr := range prs {
+			if ch.covers(pr.Org, pr.Repo) && now.Sub(pr.Since) >= minAge {
+				overdue = append(overdue, pr)
+			}
+		}
+		sort.Slice(overdue, func(i, j int) bool { return overdue[i].Since.Before(overdue[j].Since) })
+
+		kind := "alert"
+		announce := overdue
+		if last, ok := n.lastDigest[ch.Name]; !ok || now.Sub(last) >= digestPeriod {
+			kind = "digest"
+		} else {
+			announce = nil
+			for _, pr := range overdue {
+				if at, ok := n.announced[announcement{ch.Name, pr.key()}]; !ok || now.Sub(at) >= window {
+					announce = append(announce, pr)
+				}
+			}
+		}
+		if len(announce) == 0 {
+			if kind == "digest" && !dryRun {
+				n.lastDigest[ch.Name] = now
+			}
+			continue
+		}
+
+		l := log.WithFields(logrus.Fields{"channel": ch.Name, "kind": kind, "prs": len(announce)})
+		if dryRun {
+			l.WithField("text", message(ch, kind, announce, minAge)).Info("Planned notification.")
+			continue
+		}
+		if err := n.post(ch, message(ch, kind, announce, minAge)); err != nil {
+			l.WithError(err).Error("Error posting notification.")
+			metrics.Notifications.WithLabelValues(kind, "failure").Inc()
+			lastErr = err
+			continue
+		}
+		l.Info("Posted notification.")
+		metrics.Notifications.WithLabelValues(kind, "success").Inc()
+		if kind == "digest" {
+			n.lastDigest[ch.Name] = now
+		}
+		for _, pr := range announce {
+			n.announced[announcement{ch.Name, pr.key()}] = now
+		}
+	}
+	return lastErr
+}
+
+// covers returns true if the channel announces PRs in org/repo.
+func (ch Channel) covers(org, repo string) bool {
+	for _, r := range ch.Repos {
+		if r == org || r == org+"/"+repo {
+			return true
+		}
+	}
+	return false
+}
+
+// message returns the text announcing the PRs to the channel.
+func message(ch Channel, kind string, prs []PR, minAge time.Duration) string {
+	var lines []string
+	if kind == "digest" {
+		lines = append(lines, fmt.Sprintf("Daily digest: %d PR(s) have carried the `needs-retitle` label for over %v:", len(prs), minAge))
+	} else {
+		lines = append(lines, fmt.Sprintf("%d PR(s) have carried the `needs-retitle` label for over %v:", len(prs), minAge))
+	}
+	for _, pr := range prs {
+		lines = append(lines, fmt.Sprintf("• %s %s by %s, labelled since %s", link(ch.Format, pr.URL, pr.key()), pr.Title, pr.Author, pr.Since.UTC().Format("2006-01-02 15:04 MST")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func link(format, url, text string) string {
+	if format == FormatMattermost {
+		return fmt.Sprintf("[%s](%s)", text, url)
+	}
+	return fmt.Sprintf("<%s|%s>", url, text)
+}
+
+// post sends the text to the incoming webhook of the channel. Both Slack and
+// Mattermost take a JSON payload with a text field.
+func (n *Notifier) post(ch Channel, text string) error {
+	url := ch.WebhookURL
+	if len(ch.WebhookURLFile) > 0 {
+		b, err := ioutil.ReadFile(ch.WebhookURLFile)
+		if err != nil {
+			return fmt.Errorf("reading the webhook URL: %w", err)
+		}
+		url = strings.TrimSpace(string(b))
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook responded with %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
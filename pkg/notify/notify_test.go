@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhook is a local stand-in for an incoming webhook, recording the texts
+// posted to it.
+type webhook struct {
+	mut    sync.Mutex
+	texts  []string
+	status int
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if w.status != 0 {
+		rw.WriteHeader(w.status)
+		return
+	}
+	w.texts = append(w.texts, payload.Text)
+}
+
+func (w *webhook) take() []string {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	texts := w.texts
+	w.texts = nil
+	return texts
+}
+
+func TestNotify(t *testing.T) {
+	slack, mattermost := &webhook{}, &webhook{}
+	slackServer, mattermostServer := httptest.NewServer(slack), httptest.NewServer(mattermost)
+	defer slackServer.Close()
+	defer mattermostServer.Close()
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	n := NewNotifier()
+	n.now = func() time.Time { return now }
+	n.Configure(Config{
+		MinAge: "48h",
+		Window: "12h",
+		Channels: []Channel{
+			{Name: "team-a", WebhookURL: slackServer.URL, Repos: []string{"org"}},
+			{Name: "team-b", WebhookURL: mattermostServer.URL, Format: FormatMattermost, Repos: []string{"org/b"}},
+		},
+	})
+	log := logrus.WithField("test", t.Name())
+
+	old := PR{Org: "org", Repo: "a", Number: 1, Title: "old", Author: "alice", URL: "https://github.com/org/a/pull/1", Since: now.Add(-72 * time.Hour)}
+	young := PR{Org: "org", Repo: "b", Number: 2, Title: "young", Author: "bob", URL: "https://github.com/org/b/pull/2", Since: now.Add(-47*time.Hour - 30*time.Minute)}
+	other := PR{Org: "other", Repo: "c", Number: 3, Title: "other", Author: "carol", URL: "https://github.com/other/c/pull/3", Since: now.Add(-72 * time.Hour)}
+
+	// In dry run nothing is posted or recorded as announced.
+	assert.NoError(t, n.Notify(log, []PR{old, young, other}, true))
+	assert.Empty(t, slack.take())
+	assert.Empty(t, mattermost.take())
+	assert.Empty(t, n.State().Announced)
+	assert.Empty(t, n.State().LastDigest)
+
+	// The first pass sends a digest to each channel with overdue PRs.
+	assert.NoError(t, n.Notify(log, []PR{old, young, other}, false))
+	assert.Equal(t, []string{"Daily digest: 1 PR(s) have carried the `needs-retitle` label for over 48h0m0s:\n" +
+		"• <https://github.com/org/a/pull/1|org/a#1> old by alice, labelled since 2022-08-29 12:00 UTC"}, slack.take())
+	assert.Empty(t, mattermost.take())
+
+	// Once the young PR is overdue it's announced, the old one isn't again.
+	now = now.Add(time.Hour)
+	assert.NoError(t, n.Notify(log, []PR{old, young}, false))
+	assert.Equal(t, []string{"1 PR(s) have carried the `needs-retitle` label for over 48h0m0s:\n" +
+		"• <https://github.com/org/b/pull/2|org/b#2> young by bob, labelled since 2022-08-30 12:30 UTC"}, slack.take())
+	assert.Equal(t, []string{"1 PR(s) have carried the `needs-retitle` label for over 48h0m0s:\n" +
+		"• [org/b#2](https://github.com/org/b/pull/2) young by bob, labelled since 2022-08-30 12:30 UTC"}, mattermost.take())
+
+	// Nothing is announced again within the window.
+	now = now.Add(time.Hour)
+	assert.NoError(t, n.Notify(log, []PR{old, young}, false))
+	assert.Empty(t, slack.take())
+	assert.Empty(t, mattermost.take())
+
+	// Failed digests are retried on the next pass.
+	now = now.Add(24 * time.Hour)
+	slack.status = http.StatusInternalServerError
+	assert.Error(t, n.Notify(log, []PR{young}, false))
+	assert.Len(t, mattermost.take(), 1)
+	slack.status = 0
+	assert.NoError(t, n.Notify(log, []PR{young}, false))
+	assert.Len(t, slack.take(), 1)
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      Config
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			config: Config{MinAge: "24h", Channels: []Channel{
+				{Name: "a", WebhookURL: "https://hooks.slack.com/services/x", Repos: []string{"org"}},
+				{Name: "b", WebhookURLFile: "/etc/webhooks/b", Format: FormatMattermost, Repos: []string{"org/repo"}},
+			}},
+		},
+		{
+			name:        "invalid duration",
+			config:      Config{Window: "a day"},
+			expectedErr: `window: time: invalid duration "a day"`,
+		},
+		{
+			name:        "two webhooks",
+			config:      Config{Channels: []Channel{{Name: "a", WebhookURL: "https://a", WebhookURLFile: "/a", Repos: []string{"org"}}}},
+			expectedErr: `channel "a": exactly one of webhook_url and webhook_url_file is required`,
+		},
+		{
+			name:        "unknown format",
+			config:      Config{Channels: []Channel{{Name: "a", WebhookURL: "https://a", Format: "teams", Repos: []string{"org"}}}},
+			expectedErr: `channel "a": invalid format "teams", valid formats are slack, mattermost`,
+		},
+		{
+			name:        "no repos",
+			config:      Config{Channels: []Channel{{Name: "a", WebhookURL: "https://a"}}},
+			expectedErr: `channel "a": at least one org or repo is required`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if len(tc.expectedErr) > 0 {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
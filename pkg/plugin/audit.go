@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/audit"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// scanIDField is the log field holding the ID of the scan, recorded in the
+// audit log for the changes made by the scan.
+const scanIDField = "scan_id"
+
+// SetAuditSink sets where the changes made to PRs are recorded. In dry run
+// the records are marked as changes that were only planned.
+func (p *Plugin) SetAuditSink(s audit.Sink) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.auditSink = s
+}
+
+// withScanID adds a new scan ID to the log, unless it already has one.
+func withScanID(log *logrus.Entry) *logrus.Entry {
+	if _, ok := log.Data[scanIDField]; ok {
+		return log
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return log
+	}
+	return log.WithField(scanIDField, hex.EncodeToString(b))
+}
+
+// writeAudit records a change made to the PR, along with the evaluation of
+// its title and the config it was made with, if any. The webhook event or
+// the scan the change was made for is taken from the log.
+func (p *Plugin) writeAudit(log *logrus.Entry, c *pluginConfig, pr prContext, action ActionType, detail string, e *Evaluation) {
+	p.mut.Lock()
+	sink, dryRun := p.auditSink, p.dryRun
+	p.mut.Unlock()
+	if sink == nil {
+		return
+	}
+
+	r := audit.Record{
+		Time:   time.Now().UTC(),
+		Org:    pr.Org,
+		Repo:   pr.Repo,
+		Number: pr.Number,
+		Action: string(action),
+		Detail: detail,
+		Title:  pr.Title,
+		DryRun: dryRun,
+	}
+	if guid, ok := log.Data[github.EventGUID].(string); ok {
+		r.EventGUID = guid
+	}
+	if id, ok := log.Data[scanIDField].(string); ok {
+		r.ScanID = id
+	}
+	if c != nil {
+		r.ConfigHash = c.settings.ConfigHash
+		r.Shadow = c.shadow(pr.Org, pr.Repo)
+		r.DryRun = r.DryRun || r.Shadow
+		if e != nil {
+			r.Verdict = e.Verdict
+			r.Rules = c.ruleVerdicts(e)
+		}
+	}
+	if err := sink.Write(r); err != nil {
+		log.WithError(err).Error("Error writing audit record.")
+	}
+}
+
+// ruleVerdicts returns whether the title evaluated followed each rule.
+func (c *pluginConfig) ruleVerdicts(e *Evaluation) []audit.RuleVerdict {
+	failed, exempt := map[string]bool{}, map[string]bool{}
+	for _, f := range e.Failures {
+		failed[f.Rule] = true
+	}
+	for _, name := range e.Exempt {
+		exempt[name] = true
+	}
+	verdicts := make([]audit.RuleVerdict, 0, len(c.rules))
+	for _, r := range c.rules {
+		verdicts = append(verdicts, audit.RuleVerdict{Rule: r.name, Severity: r.severity, Passed: !failed[r.name], Exempt: exempt[r.name]})
+	}
+	return verdicts
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/audit"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+type memSink struct {
+	records []audit.Record
+}
+
+func (s *memSink) Write(r audit.Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memSink) Close() error {
+	return nil
+}
+
+func TestTakeActionAudit(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp:     regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Rules:      []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}},
+		ConfigHash: "abc123",
+	})
+	sink := &memSink{}
+	testSubject := &Plugin{c: c}
+	testSubject.SetAuditSink(sink)
+	log := logrus.WithFields(logrus.Fields{"plugin": PluginName, github.EventGUID: "guid-1"})
+
+	_, err := testSubject.takeAction(log, newFakeClient(nil, nil, nil), testPR("this title is far too long"), nil, c)
+	assert.NoError(t, err)
+	if assert.Len(t, sink.records, 2) {
+		for _, r := range sink.records {
+			assert.Equal(t, "guid-1", r.EventGUID)
+			assert.Empty(t, r.ScanID)
+			assert.Equal(t, "org", r.Org)
+			assert.Equal(t, "repo", r.Repo)
+			assert.Equal(t, 1, r.Number)
+			assert.Equal(t, "this title is far too long", r.Title)
+			assert.Equal(t, VerdictFail, r.Verdict)
+			assert.Equal(t, "abc123", r.ConfigHash)
+			assert.Equal(t, []audit.RuleVerdict{
+				{Rule: regexpRule, Severity: SeverityError, Passed: false},
+				{Rule: "length", Severity: SeverityWarning, Passed: false},
+			}, r.Rules)
+			assert.False(t, r.DryRun)
+		}
+		assert.Equal(t, string(ActionAddLabel), sink.records[0].Action)
+		assert.Equal(t, needsRetitleLabel, sink.records[0].Detail)
+		assert.Equal(t, string(ActionCreateComment), sink.records[1].Action)
+	}
+
+	// Scans record their ID instead.
+	sink.records = nil
+	log = withScanID(logrus.WithField("plugin", PluginName))
+	_, err = testSubject.takeAction(log, newFakeClient(nil, nil, nil), testPR("fix: short"), []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, sink.records) {
+		assert.Empty(t, sink.records[0].EventGUID)
+		assert.Equal(t, log.Data[scanIDField], sink.records[0].ScanID)
+		assert.Equal(t, VerdictPass, sink.records[0].Verdict)
+	}
+}
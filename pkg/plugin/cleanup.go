@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// Cleanup removes the "needs-retitle" label and prunes the comments of the
+// bot from the open PRs in the allowed orgs whose repo doesn't enable this
+// plugin anymore, so they aren't blocked forever. With dryRun the actions
+// are only returned, nothing is changed.
+func (p *Plugin) Cleanup(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, allowedOrgs []string, dryRun bool) (*ScanResult, error) {
+	if !p.scanMut.TryLock() {
+		return nil, ErrScanInProgress
+	}
+	defer p.scanMut.Unlock()
+
+	result := &ScanResult{DryRun: dryRun}
+	if len(allowedOrgs) == 0 {
+		return result, nil
+	}
+	log = log.WithField("dry-run", dryRun)
+	log.Infof("Cleaning up PRs in repos that disabled the %s plugin.", PluginName)
+
+	orgs, repos := config.EnabledReposForExternalPlugin(PluginName)
+	enabled := map[string]bool{}
+	for _, key := range append(orgs, repos...) {
+		enabled[key] = true
+	}
+
+	log = withScanID(log)
+	c := p.GetConfig()
+	var prune func(github.IssueComment) bool
+	if c != nil {
+		botUser, err := ghc.BotUser()
+		if err != nil {
+			metrics.GitHubErrors.WithLabelValues("bot_user").Inc()
+			return nil, err
+		}
+		prune = shouldPrune(botUser.Login, c.errorMessage)
+	} else {
+		log.Warnf("No regular expression provided, comments won't be pruned")
+	}
+
+	base := fmt.Sprintf("archived:false is:pr is:open label:\"%s\"", needsRetitleLabel)
+	err := searchPartitioned(context.Background(), log, ghc, base, partition{orgs: allowedOrgs}, p.GetScanOptions().MinRateLimit, func(pr pullRequest) {
+		org := string(pr.Repository.Owner.Login)
+		repo := string(pr.Repository.Name)
+		num := int(pr.Number)
+		if enabled[org] || enabled[org+"/"+repo] {
+			return
+		}
+		l := log.WithFields(logrus.Fields{
+			"org":  org,
+			"repo": repo,
+			"pr":   num,
+		})
+		result.Checked++
+		target := prContext{Org: org, Repo: repo, Number: num, Author: string(pr.Author.Login), Title: string(pr.Title), BaseBranch: string(pr.BaseRefName), CreatedAt: pr.CreatedAt.Time}
+
+		if prune != nil {
+			if !dryRun {
+				p.comments.forget(org, repo, num)
+				deleted := 0
+				if err := retry(l, "delete_stale_comments", func() error {
+					return ghc.DeleteStaleComments(org, repo, num, nil, func(ic github.IssueComment) bool {
+						if prune(ic) {
+							deleted++
+							return true
+						}
+						return false
+					})
+				}); err != nil {
+					l.WithError(err).Error("Failed to prune comments.")
+					result.addError(org, repo, num, err)
+					return
+				}
+				metrics.Comments.WithLabelValues("deleted").Add(float64(deleted))
+				p.writeAudit(l, c, target, ActionPruneComments, "", nil)
+			}
+			result.Actions = append(result.Actions, Action{Org: org, Repo: repo, Number: num, Type: ActionPruneComments})
+		}
+
+		// The label is removed last, so PRs whose comments couldn't be
+		// pruned are found again by the next cleanup.
+		l.Infof("Removing %q label from PR in disabled repo.", needsRetitleLabel)
+		if !dryRun {
+			if err := retry(l, "remove_label", func() error {
+				return removeLabel(ghc, org, repo, num, needsRetitleLabel)
+			}); err != nil {
+				l.WithError(err).Errorf("Failed to remove %q label.", needsRetitleLabel)
+				result.addError(org, repo, num, err)
+				return
+			}
+			metrics.Labels.WithLabelValues("removed").Inc()
+			p.writeAudit(l, c, target, ActionRemoveLabel, needsRetitleLabel, nil)
+		}
+		result.Actions = append(result.Actions, Action{Org: org, Repo: repo, Number: num, Type: ActionRemoveLabel, Label: needsRetitleLabel})
+	})
+	if err != nil {
+		metrics.GitHubErrors.WithLabelValues("search").Inc()
+		return nil, err
+	}
+	log.Infof("Cleaned up %d PRs.", result.Checked)
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestCleanup(t *testing.T) {
+	newPR := func(org, repo string, num int) pullRequest {
+		pr := pullRequest{Number: githubql.Int(num), Title: "wrong title"}
+		pr.Repository.Owner.Login = githubql.String(org)
+		pr.Repository.Name = githubql.String(repo)
+		pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{needsRetitleLabel})
+		return pr
+	}
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{
+			"enabled":       {{Name: PluginName}},
+			"org/enabled":   {{Name: PluginName}},
+			"org/other":     {{Name: "other-plugin"}},
+			"other/enabled": {{Name: PluginName}},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		allowedOrgs []string
+		dryRun      bool
+
+		expectedActions int
+		expectRemoved   bool
+	}{
+		{
+			name: "no allowed orgs",
+		},
+		{
+			name:            "dry run",
+			allowedOrgs:     []string{"org"},
+			dryRun:          true,
+			expectedActions: 2,
+		},
+		{
+			name:            "cleanup",
+			allowedOrgs:     []string{"org"},
+			expectedActions: 2,
+			expectRemoved:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testSubject := &Plugin{}
+			testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+			fake := newFakeClient([]pullRequest{
+				newPR("enabled", "repo", 1),
+				newPR("org", "enabled", 2),
+				newPR("org", "disabled", 3),
+			}, nil, nil)
+
+			result, err := testSubject.Cleanup(logrus.WithField("plugin", PluginName), fake, config, tc.allowedOrgs, tc.dryRun)
+			assert.NoError(t, err)
+			assert.Len(t, result.Actions, tc.expectedActions)
+
+			fake.compareExpected(t, "enabled", "repo", 1, nil, nil, false, false)
+			fake.compareExpected(t, "org", "enabled", 2, nil, nil, false, false)
+			if tc.expectRemoved {
+				fake.compareExpected(t, "org", "disabled", 3, nil, []string{needsRetitleLabel}, false, true)
+			} else {
+				fake.compareExpected(t, "org", "disabled", 3, nil, nil, false, false)
+			}
+		})
+	}
+}
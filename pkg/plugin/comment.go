@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// noticeMarker is hidden in the comments the plugin posts about titles, to
+// tell them apart from other comments.
+const noticeMarker = "<!-- needs-retitle -->"
+
+// notice returns the comment for the error and warning rules broken by the
+// title of the PR, or an empty string if there are none. The comment lists
+// the rules broken in a table, followed by the example titles, the link to
+// the docs and the patterns of the rules in a collapsible block. Rules with
+// a built-in message, which shows the pattern, get a generic reason in the
+// table, so patterns are only shown in the collapsible block.
+func (c *pluginConfig) notice(pr prContext, e *Evaluation) string {
+	var reported []Failure
+	for _, f := range e.Failures {
+		if f.Severity != SeverityNotice {
+			reported = append(reported, f)
+		}
+	}
+	if len(reported) == 0 {
+		return ""
+	}
+
+	language := c.languageFor(pr.Org, pr.Repo)
+	text := func(field func(Catalogue) string) string {
+		return render(c.text(language, field), c.data(pr, "", ""))
+	}
+
+	lines := []string{
+		text(func(cat Catalogue) string { return cat.RulesHeader }),
+		"",
+		fmt.Sprintf("| %s | %s | %s |",
+			text(func(cat Catalogue) string { return cat.RuleColumn }),
+			text(func(cat Catalogue) string { return cat.SeverityColumn }),
+			text(func(cat Catalogue) string { return cat.ReasonColumn })),
+		"| --- | --- | --- |",
+	}
+	for _, f := range reported {
+		reason := f.Message
+		if r, ok := c.rule(f.Rule); ok && len(c.configuredMessage(r, language)) == 0 {
+			reason = text(func(cat Catalogue) string { return cat.Reason })
+		}
+		severity := text(func(cat Catalogue) string { return cat.ErrorSeverity })
+		if f.Severity == SeverityWarning {
+			severity = text(func(cat Catalogue) string { return cat.WarningSeverity })
+		}
+		lines = append(lines, fmt.Sprintf("| `%s` | %s | %s |", f.Rule, severity, tableCell(reason)))
+	}
+
+	if len(c.settings.Examples) > 0 {
+		lines = append(lines, "", text(func(cat Catalogue) string { return cat.ExamplesHeader }), "")
+		for _, example := range c.settings.Examples {
+			lines = append(lines, "- `"+example+"`")
+		}
+	}
+
+	if len(c.settings.DocsURL) > 0 {
+		lines = append(lines, "", text(func(cat Catalogue) string { return cat.DocsLink }))
+	}
+
+	lines = append(lines,
+		"",
+		"<details>",
+		"<summary>"+text(func(cat Catalogue) string { return cat.DetailsSummary })+"</summary>",
+	)
+	for _, f := range reported {
+		if r, ok := c.rule(f.Rule); ok {
+			lines = append(lines, "",
+				fmt.Sprintf("%s `%s`:", text(func(cat Catalogue) string { return cat.PatternColumn }), r.name),
+				"",
+				codeBlock(r.re.String()))
+		}
+	}
+	lines = append(lines, "", "</details>")
+
+	msg := strings.Join(lines, "\n")
+	if c.settings.mentionAuthor() {
+		msg = plugins.FormatSimpleResponse(pr.Author, msg)
+	}
+	return noticeMarker + "\n" + msg
+}
+
+// rule returns the rule with the name.
+func (c *pluginConfig) rule(name string) (rule, bool) {
+	for _, r := range c.rules {
+		if r.name == name {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+// codeBlock returns the text in a fenced code block, with a fence longer
+// than any run of backticks in the text.
+func codeBlock(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + text + "\n" + fence
+}
+
+// tableCell escapes the text so it fits in a cell of a Markdown table.
+func tableCell(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
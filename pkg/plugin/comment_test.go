@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestNotice(t *testing.T) {
+	mention := false
+	testCases := []struct {
+		name     string
+		settings Settings
+		title    string
+		// expected is the comment without the marker and the mention.
+		expected string
+	}{
+		{
+			name:     "title follows the rules",
+			settings: Settings{Regexp: regexp.MustCompile("^fix: .*$")},
+			title:    "fix: it",
+		},
+		{
+			name: "notices aren't reported",
+			settings: Settings{
+				Regexp: regexp.MustCompile("^fix: .*$"),
+				Rules:  []Rule{{Name: "length", Regexp: "^.{0,5}$", Severity: SeverityNotice}},
+			},
+			title: "fix: it",
+		},
+		{
+			name: "rules broken",
+			settings: Settings{
+				Regexp:       regexp.MustCompile("^(fix|feat): .*$"),
+				ErrorMessage: "Titles start with the type of change,\nfix or feat.",
+				Rules:        []Rule{{Name: "length", Regexp: "^.{0,10}$", Message: "Keep {{.Repo}} titles short.", Severity: SeverityWarning}},
+				Examples:     []string{"fix: typo", "feat: login"},
+				DocsURL:      "https://example.com/contributing",
+			},
+			title: "wrong title",
+			expected: `The title breaks these rules:
+
+| Rule | Severity | Reason |
+| --- | --- | --- |
+| ` + "`regexp`" + ` | error | Titles start with the type of change,<br>fix or feat. |
+| ` + "`length`" + ` | warning | Keep repo titles short. |
+
+Titles like these follow the rules:
+
+- ` + "`fix: typo`" + `
+- ` + "`feat: login`" + `
+
+See the [contribution guide](https://example.com/contributing) for more about titles.
+
+<details>
+<summary>Patterns of the rules</summary>
+
+Pattern ` + "`regexp`" + `:
+
+` + "```" + `
+^(fix|feat): .*$
+` + "```" + `
+
+Pattern ` + "`length`" + `:
+
+` + "```" + `
+^.{0,10}$
+` + "```" + `
+
+</details>`,
+		},
+		{
+			name: "author not mentioned",
+			settings: Settings{
+				Regexp:        regexp.MustCompile("^fix: .*$"),
+				MentionAuthor: &mention,
+				Language:      "de",
+			},
+			title: "wrong title",
+			expected: `Der Titel verstößt gegen diese Regeln:
+
+| Regel | Schweregrad | Grund |
+| --- | --- | --- |
+| ` + "`regexp`" + ` | Fehler | Der Titel entspricht nicht dem Muster der Regel. |
+
+<details>
+<summary>Muster der Regeln</summary>
+
+Muster ` + "`regexp`" + `:
+
+` + "```" + `
+^fix: .*$
+` + "```" + `
+
+</details>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newPluginConfig(tc.settings)
+			pr := testPR(tc.title)
+			expected := tc.expected
+			if len(expected) > 0 {
+				if tc.settings.mentionAuthor() {
+					expected = plugins.FormatSimpleResponse("author", expected)
+				}
+				expected = noticeMarker + "\n" + expected
+			}
+			assert.Equal(t, expected, c.notice(pr, c.evaluate(pr)))
+		})
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	assert.Equal(t, "```\n^fix: .*$\n```", codeBlock("^fix: .*$"))
+	assert.Equal(t, "````\n^```.*$\n````", codeBlock("^```.*$"))
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// commentCacheSize is the number of PRs whose comments are cached.
+	commentCacheSize = 10000
+	// commentCacheTTL is how long comments are cached, so the ones changed
+	// by others are eventually seen.
+	commentCacheTTL = 24 * time.Hour
+)
+
+// commentCache keeps the comments of the bot on each PR as last listed, so
+// PRs whose comments don't need to change are handled without listing them.
+// The plugin forgets a PR whenever it changes its comments, and the PRs that
+// aren't cached, as after a restart, get their comments listed again.
+type commentCache struct {
+	mut sync.Mutex
+	// prs holds the *commentEntry of each org/repo#number.
+	prs *lru
+}
+
+// commentEntry is the comments of the bot on a PR and when they were listed.
+type commentEntry struct {
+	comments []github.IssueComment
+	listed   time.Time
+}
+
+func (cc *commentCache) get(org, repo string, num int) ([]github.IssueComment, bool) {
+	cc.mut.Lock()
+	defer cc.mut.Unlock()
+	if cc.prs == nil {
+		return nil, false
+	}
+	v, ok := cc.prs.get(planKey(org, repo, num))
+	if !ok || time.Since(v.(*commentEntry).listed) >= commentCacheTTL {
+		return nil, false
+	}
+	return v.(*commentEntry).comments, true
+}
+
+func (cc *commentCache) put(org, repo string, num int, comments []github.IssueComment) {
+	cc.mut.Lock()
+	defer cc.mut.Unlock()
+	if cc.prs == nil {
+		cc.prs = newLRU(commentCacheSize)
+	}
+	cc.prs.put(planKey(org, repo, num), &commentEntry{comments: comments, listed: time.Now()})
+}
+
+// forget drops the comments of the PR, so they're listed the next time
+// they're needed.
+func (cc *commentCache) forget(org, repo string, num int) {
+	cc.mut.Lock()
+	defer cc.mut.Unlock()
+	if cc.prs != nil {
+		cc.prs.remove(planKey(org, repo, num))
+	}
+}
+
+// botComments returns the login of the bot and its comments on the PR, which
+// are only listed if they aren't cached.
+func (p *Plugin) botComments(log *logrus.Entry, ghc githubClient, org, repo string, num int) (string, []github.IssueComment, error) {
+	var botUser *github.UserData
+	if err := retry(log, "bot_user", func() (err error) {
+		botUser, err = ghc.BotUser()
+		return err
+	}); err != nil {
+		return "", nil, fmt.Errorf("getting the bot user: %w", err)
+	}
+	if comments, ok := p.comments.get(org, repo, num); ok {
+		return botUser.Login, comments, nil
+	}
+
+	var comments []github.IssueComment
+	if err := retry(log, "list_issue_comments", func() (err error) {
+		comments, err = ghc.ListIssueComments(org, repo, num)
+		return err
+	}); err != nil {
+		return "", nil, fmt.Errorf("listing comments: %w", err)
+	}
+	var own []github.IssueComment
+	for _, ic := range comments {
+		if github.NormLogin(ic.User.Login) == github.NormLogin(botUser.Login) {
+			own = append(own, ic)
+		}
+	}
+	p.comments.put(org, repo, num, own)
+	return botUser.Login, own, nil
+}
@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestBotComments(t *testing.T) {
+	testSubject := &Plugin{}
+	log := logrus.WithField("plugin", PluginName)
+	fake := newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{
+		{ID: 1, User: github.User{Login: "someone"}, Body: "LGTM"},
+		{ID: 2, User: github.User{Login: "me"}, Body: noticeMarker},
+	}
+	expected := []github.IssueComment{{ID: 2, User: github.User{Login: "me"}, Body: noticeMarker}}
+
+	// The comments of the bot are listed once.
+	for i := 0; i < 2; i++ {
+		login, comments, err := testSubject.botComments(log, fake, "org", "repo", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "me", login)
+		assert.Equal(t, expected, comments)
+		assert.Equal(t, 1, fake.commentRequests)
+	}
+
+	// They're listed again once forgotten or once they're too old.
+	testSubject.comments.forget("org", "repo", 1)
+	_, _, err := testSubject.botComments(log, fake, "org", "repo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fake.commentRequests)
+
+	testSubject.comments.prs.put(planKey("org", "repo", 1), &commentEntry{comments: expected, listed: time.Now().Add(-commentCacheTTL)})
+	_, _, err = testSubject.botComments(log, fake, "org", "repo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fake.commentRequests)
+}
@@ -0,0 +1,203 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// EscalationRemind pings the author of the PR again.
+	EscalationRemind = "remind"
+	// EscalationRequestAttention mentions the assignees and the requested
+	// reviewers of the PR.
+	EscalationRequestAttention = "request_attention"
+	// EscalationClose closes the PR with an explanation.
+	EscalationClose = "close"
+
+	// ActionEscalate is the action type of escalation steps.
+	ActionEscalate ActionType = "escalate"
+	// ActionClose is recorded in the audit log for PRs closed by the close
+	// step.
+	ActionClose ActionType = "close"
+)
+
+// EscalationActions are the valid escalation step actions.
+var EscalationActions = []string{EscalationRemind, EscalationRequestAttention, EscalationClose}
+
+// EscalationStep is taken once a PR has carried the "needs-retitle" label
+// for After.
+type EscalationStep struct {
+	After   string `json:"after"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+// ValidateEscalation checks the steps have valid durations in increasing
+// order, valid actions used once each, and valid messages.
+func ValidateEscalation(steps []EscalationStep) error {
+	var last time.Duration
+	actions := map[string]bool{}
+	for i, s := range steps {
+		after, err := time.ParseDuration(s.After)
+		if err != nil {
+			return fmt.Errorf("step %d: after: %v", i, err)
+		}
+		if after <= last {
+			return fmt.Errorf("step %d: after must be longer than the previous step", i)
+		}
+		last = after
+		valid := false
+		for _, a := range EscalationActions {
+			valid = valid || a == s.Action
+		}
+		if !valid {
+			return fmt.Errorf("step %d: invalid action %q, valid actions are %s", i, s.Action, strings.Join(EscalationActions, ", "))
+		}
+		if actions[s.Action] {
+			return fmt.Errorf("step %d: duplicate action %q", i, s.Action)
+		}
+		actions[s.Action] = true
+		if err := ValidateMessage(s.Message); err != nil {
+			return fmt.Errorf("step %d: message: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// escalationMarker is hidden in the comment posted by the step, so each
+// step is only taken once per PR.
+func escalationMarker(action string) string {
+	return "<!-- needs-retitle escalation: " + action + " -->"
+}
+
+// escalate takes the next escalation step due for the PR, given how long it
+// has carried the label: the first step after the last one taken. Only one
+// step is taken per run, so a PR that is already past several steps when
+// escalation is enabled gets them one run at a time, and is reminded before
+// it is closed. c is the effective config for the PR.
+func (p *Plugin) escalate(log *logrus.Entry, ghc githubClient, c *pluginConfig, l labelledPR, now time.Time) (*Action, error) {
+	due := -1
+	for i, s := range c.settings.Escalation {
+		// Steps are validated when loaded, invalid ones are skipped.
+		if after, err := time.ParseDuration(s.After); err == nil && now.Sub(l.since) >= after {
+			due = i
+		}
+	}
+	if due < 0 {
+		return nil, nil
+	}
+
+	org, repo, num := string(l.pr.Repository.Owner.Login), string(l.pr.Repository.Name), int(l.pr.Number)
+	var botUser *github.UserData
+	if err := retry(log, "bot_user", func() (err error) {
+		botUser, err = ghc.BotUser()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("getting the bot user: %w", err)
+	}
+	var comments []github.IssueComment
+	if err := retry(log, "list_issue_comments", func() (err error) {
+		comments, err = ghc.ListIssueComments(org, repo, num)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("listing comments: %w", err)
+	}
+	next := 0
+	for i, s := range c.settings.Escalation {
+		for _, ic := range comments {
+			if github.NormLogin(ic.User.Login) == github.NormLogin(botUser.Login) && strings.Contains(ic.Body, escalationMarker(s.Action)) {
+				next = i + 1
+				break
+			}
+		}
+	}
+	if next > due {
+		return nil, nil
+	}
+
+	step := c.settings.Escalation[next]
+	pr := prContext{
+		Org:        org,
+		Repo:       repo,
+		Number:     num,
+		Author:     string(l.pr.Author.Login),
+		Title:      string(l.pr.Title),
+		BaseBranch: string(l.pr.BaseRefName),
+		CreatedAt:  l.pr.CreatedAt.Time,
+	}
+	data := c.data(pr, "", "")
+	if step.Action == EscalationRequestAttention {
+		var full *github.PullRequest
+		if err := retry(log, "get_pull_request", func() (err error) {
+			full, err = ghc.GetPullRequest(org, repo, num)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("getting the PR: %w", err)
+		}
+		data.Mentions = mentions(pr.Author, full)
+	}
+	message := step.Message
+	if len(message) == 0 {
+		language := c.languageFor(org, repo)
+		message = c.text(language, func(cat Catalogue) string {
+			switch step.Action {
+			case EscalationRemind:
+				return cat.RemindMessage
+			case EscalationRequestAttention:
+				return cat.AttentionMessage
+			default:
+				return cat.CloseMessage
+			}
+		})
+	}
+	body := escalationMarker(step.Action) + "\n" + render(message, data)
+
+	log = log.WithFields(logrus.Fields{"org": org, "repo": repo, "pr": num, "step": step.Action})
+	action := &Action{Org: org, Repo: repo, Number: num, Type: ActionEscalate, Step: step.Action}
+	if p.DryRun() || c.shadow(org, repo) {
+		log.WithField("action", action).Info("Planned escalation of PR.")
+		return action, nil
+	}
+	evaluation := c.evaluate(pr)
+	// The PR is closed before the comment is posted, as the marker in the
+	// comment means the step was taken.
+	if step.Action == EscalationClose {
+		if err := retry(log, "close_pr", func() error {
+			return ghc.ClosePR(org, repo, num)
+		}); err != nil {
+			return nil, fmt.Errorf("closing the PR: %w", err)
+		}
+		p.writeAudit(log, c, pr, ActionClose, "", evaluation)
+	}
+	p.comments.forget(org, repo, num)
+	if err := retry(log, "create_comment", func() error {
+		return ghc.CreateComment(org, repo, num, body)
+	}); err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+	metrics.Comments.WithLabelValues("created").Inc()
+	p.writeAudit(log, c, pr, ActionCreateComment, step.Action, evaluation)
+	metrics.Escalations.WithLabelValues(step.Action).Inc()
+	log.Info("Escalated PR.")
+	return action, nil
+}
+
+// mentions returns the assignees and the requested reviewers of the PR to
+// mention, other than the author.
+func mentions(author string, pr *github.PullRequest) string {
+	seen := map[string]bool{github.NormLogin(author): true}
+	var logins []string
+	for _, u := range append(append([]github.User{}, pr.Assignees...), pr.RequestedReviewers...) {
+		if login := github.NormLogin(u.Login); !seen[login] {
+			seen[login] = true
+			logins = append(logins, "@"+u.Login)
+		}
+	}
+	return strings.Join(logins, " ")
+}
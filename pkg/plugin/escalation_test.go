@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestEscalate(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Escalation: []EscalationStep{
+			{After: "72h", Action: EscalationRemind},
+			{After: "168h", Action: EscalationRequestAttention},
+			{After: "720h", Action: EscalationClose, Message: "Closing {{.Org}}/{{.Repo}}#{{.Number}}, @{{.Author}}."},
+		},
+	})
+	testSubject := &Plugin{c: c}
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+	now := time.Now()
+
+	pr := pullRequest{Number: 1, Title: "wrong title"}
+	pr.Repository.Name = "repo"
+	pr.Repository.Owner.Login = "org"
+	pr.Author.Login = "author"
+	labelledFor := func(d time.Duration) labelledPR {
+		return labelledPR{pr: pr, since: now.Add(-d)}
+	}
+	botComment := func(body string) github.IssueComment {
+		return github.IssueComment{User: github.User{Login: "me"}, Body: body}
+	}
+
+	testCases := []struct {
+		name     string
+		labelled time.Duration
+		comments []github.IssueComment
+		ghPR     *github.PullRequest
+
+		expectedStep    string
+		expectedComment string
+		expectClosed    bool
+	}{
+		{
+			name:     "no step due",
+			labelled: 24 * time.Hour,
+		},
+		{
+			name:            "remind",
+			labelled:        100 * time.Hour,
+			expectedStep:    EscalationRemind,
+			expectedComment: escalationMarker(EscalationRemind) + "\n@author, this PR still carries the `needs-retitle` label. Please update its title so it can be merged.",
+		},
+		{
+			name:     "remind already taken",
+			labelled: 100 * time.Hour,
+			comments: []github.IssueComment{botComment(escalationMarker(EscalationRemind) + "\nwhatever")},
+		},
+		{
+			name:     "marker from someone else",
+			labelled: 100 * time.Hour,
+			comments: []github.IssueComment{{User: github.User{Login: "someone"}, Body: escalationMarker(EscalationRemind)}},
+
+			expectedStep:    EscalationRemind,
+			expectedComment: escalationMarker(EscalationRemind) + "\n@author, this PR still carries the `needs-retitle` label. Please update its title so it can be merged.",
+		},
+		{
+			name:     "request attention",
+			labelled: 200 * time.Hour,
+			comments: []github.IssueComment{botComment(escalationMarker(EscalationRemind))},
+			ghPR: &github.PullRequest{
+				Assignees:          []github.User{{Login: "author"}, {Login: "alice"}},
+				RequestedReviewers: []github.User{{Login: "bob"}, {Login: "Alice"}},
+			},
+			expectedStep:    EscalationRequestAttention,
+			expectedComment: escalationMarker(EscalationRequestAttention) + "\n@alice @bob: this PR has carried the `needs-retitle` label for a while, could you help @author fix its title?",
+		},
+		{
+			name:     "request attention without anyone to mention",
+			labelled: 200 * time.Hour,
+			comments: []github.IssueComment{botComment(escalationMarker(EscalationRemind))},
+			ghPR:     &github.PullRequest{},
+
+			expectedStep:    EscalationRequestAttention,
+			expectedComment: escalationMarker(EscalationRequestAttention) + "\nthis PR has carried the `needs-retitle` label for a while, could you help @author fix its title?",
+		},
+		{
+			name:     "earlier step not taken once a later one was",
+			labelled: 200 * time.Hour,
+			comments: []github.IssueComment{botComment(escalationMarker(EscalationClose))},
+		},
+		{
+			name:            "first run past every step only reminds",
+			labelled:        800 * time.Hour,
+			expectedStep:    EscalationRemind,
+			expectedComment: escalationMarker(EscalationRemind) + "\n@author, this PR still carries the `needs-retitle` label. Please update its title so it can be merged.",
+		},
+		{
+			name:     "close once the earlier steps were taken",
+			labelled: 800 * time.Hour,
+			comments: []github.IssueComment{
+				botComment(escalationMarker(EscalationRemind)),
+				botComment(escalationMarker(EscalationRequestAttention)),
+			},
+			expectedStep:    EscalationClose,
+			expectedComment: escalationMarker(EscalationClose) + "\nClosing org/repo#1, @author.",
+			expectClosed:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFakeClient(nil, nil, tc.ghPR)
+			fake.comments = tc.comments
+			action, err := testSubject.escalate(log, fake, c, labelledFor(tc.labelled), now)
+			assert.NoError(t, err)
+			if len(tc.expectedStep) == 0 {
+				assert.Nil(t, action)
+				assert.False(t, fake.commentCreated[key])
+				return
+			}
+			assert.Equal(t, &Action{Org: "org", Repo: "repo", Number: 1, Type: ActionEscalate, Step: tc.expectedStep}, action)
+			assert.Equal(t, tc.expectedComment, fake.lastComment)
+			assert.Equal(t, tc.expectClosed, fake.closed[key])
+		})
+	}
+}
+
+func TestEscalateCloseFails(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp:     regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Escalation: []EscalationStep{{After: "72h", Action: EscalationClose}},
+	})
+	testSubject := &Plugin{c: c}
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+	now := time.Now()
+	pr := pullRequest{Number: 1, Title: "wrong title"}
+	pr.Repository.Name = "repo"
+	pr.Repository.Owner.Login = "org"
+
+	// The comment marking the step as taken isn't posted unless the PR is
+	// closed, so the next run tries again.
+	fake := newFakeClient(nil, nil, nil)
+	fake.closeErr = errors.New("status code 403 not one of [200], body: Resource not accessible by integration")
+	_, err := testSubject.escalate(log, fake, c, labelledPR{pr: pr, since: now.Add(-100 * time.Hour)}, now)
+	assert.Error(t, err)
+	assert.False(t, fake.commentCreated[key])
+
+	fake.closeErr = nil
+	action, err := testSubject.escalate(log, fake, c, labelledPR{pr: pr, since: now.Add(-100 * time.Hour)}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, EscalationClose, action.Step)
+	assert.True(t, fake.closed[key])
+	assert.True(t, fake.commentCreated[key])
+}
+
+func TestFollowUpRepoEscalation(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.Configure(Settings{
+		Regexp:     regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Escalation: []EscalationStep{{After: "72h", Action: EscalationRemind}},
+	})
+	log := logrus.WithField("plugin", PluginName)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+
+	var prs []pullRequest
+	events := map[string][]github.ListedIssueEvent{}
+	for i, repo := range []string{"repo", "quiet"} {
+		pr := pullRequest{Number: githubql.Int(i + 1), Title: "wrong title", BaseRefName: "main", BaseRefOid: "abc"}
+		pr.Repository.Name = githubql.String(repo)
+		pr.Repository.Owner.Login = "org"
+		pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{Name: needsRetitleLabel})
+		prs = append(prs, pr)
+		events[testKey("org", repo, i+1)] = []github.ListedIssueEvent{{Event: github.IssueActionLabeled, Label: github.Label{Name: needsRetitleLabel}, CreatedAt: time.Now().Add(-100 * time.Hour)}}
+	}
+	fake := newFakeClient(prs, nil, nil)
+	fake.events = events
+	// The quiet repo turns escalation off.
+	fake.files = map[string]string{"org/quiet@abc": "escalation: []\n"}
+
+	assert.NoError(t, testSubject.FollowUp(log, fake, config, nil))
+	assert.True(t, fake.commentCreated[testKey("org", "repo", 1)])
+	assert.False(t, fake.commentCreated[testKey("org", "quiet", 2)])
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// VerdictPass is the verdict for titles that follow the rules.
+	VerdictPass = "pass"
+	// VerdictFail is the verdict for titles that break at least one rule.
+	VerdictFail = "fail"
+
+	// PolicyRepo is the policy of titles checked with the title policy file
+	// of the repo.
+	PolicyRepo = "repo"
+	// PolicyCentral is the policy of titles checked with the central rules,
+	// as the repo has no valid title policy file.
+	PolicyCentral = "central"
+	// PolicyCentralFallback is the policy of titles checked with the central
+	// rules because the title policy file of the repo hasn't been loaded for
+	// the branch yet, so the rules enforced on PRs can differ.
+	PolicyCentralFallback = "central_fallback"
+
+	regexpRule = "regexp"
+)
+
+// ErrNotConfigured is returned when a title is evaluated before the plugin
+// has been configured.
+var ErrNotConfigured = errors.New("no regular expression configured")
+
+// Evaluation is the outcome of checking a title against the rules.
+type Evaluation struct {
+	Verdict        string    `json:"verdict"`
+	Failures       []Failure `json:"failures,omitempty"`
+	SuggestedTitle string    `json:"suggested_title,omitempty"`
+	// Exempt are the rules the PR is exempt from, as it was created before
+	// they took effect.
+	Exempt []string `json:"exempt,omitempty"`
+	// Policy is where the rules come from, one of PolicyRepo, PolicyCentral
+	// and PolicyCentralFallback.
+	Policy string `json:"policy"`
+}
+
+// Failure is a rule broken by a title.
+type Failure struct {
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// Passed returns true if the title doesn't break any error rule.
+func (e *Evaluation) Passed() bool {
+	return e.Verdict == VerdictPass
+}
+
+// has returns true if the title breaks a rule with the severity.
+func (e *Evaluation) has(severity string) bool {
+	for _, f := range e.Failures {
+		if f.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate checks a title for a PR against the base branch of org/repo using
+// the same rules as the webhook handlers, without calling GitHub.
+func (p *Plugin) Evaluate(org, repo, branch, title string) (*Evaluation, error) {
+	c, policy := p.configFor(org, repo, branch)
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	evaluation := c.evaluate(prContext{Org: org, Repo: repo, BaseBranch: branch, Title: title})
+	evaluation.Policy = policy
+	return evaluation, nil
+}
+
+// Rules describes the effective rules for a repo.
+type Rules struct {
+	Regexp       string   `json:"regexp"`
+	ErrorMessage string   `json:"error_message"`
+	Severity     string   `json:"severity"`
+	Rules        []Rule   `json:"rules,omitempty"`
+	WarningLabel string   `json:"warning_label,omitempty"`
+	Language     string   `json:"language"`
+	LockedFields []string `json:"locked_fields,omitempty"`
+}
+
+// RulesFor returns the effective rules for PRs against the base branch of
+// org/repo.
+func (p *Plugin) RulesFor(org, repo, branch string) (*Rules, error) {
+	c, _ := p.configFor(org, repo, branch)
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	rules := &Rules{
+		Regexp:       c.re.String(),
+		ErrorMessage: c.errorMessage,
+		Severity:     severityOrDefault(c.settings.Severity),
+		Rules:        c.settings.Rules,
+		WarningLabel: c.warningLabel,
+		Language:     c.languageFor(org, repo),
+	}
+	for _, field := range LockableFields {
+		if c.locked[field] {
+			rules.LockedFields = append(rules.LockedFields, field)
+		}
+	}
+	return rules, nil
+}
+
+// configFor returns the effective config for PRs against the base branch of
+// org/repo, using the title policy file of the repo at the last commit seen
+// for the branch, and where its rules come from. Files are only loaded for
+// PRs, so the central rules are used for branches without a file loaded. It
+// returns nil if the plugin isn't configured.
+func (p *Plugin) configFor(org, repo, branch string) (*pluginConfig, string) {
+	c := p.GetConfig()
+	if c == nil {
+		return nil, ""
+	}
+	rc, loaded := p.repoConfigs.latest(org, repo, branch)
+	switch {
+	case !loaded:
+		return c, PolicyCentralFallback
+	case rc == nil:
+		return c, PolicyCentral
+	}
+	return c.merge(rc), PolicyRepo
+}
+
+// evaluate checks the title of the PR, the messages of the rules broken are
+// in the language of its repo.
+func (c *pluginConfig) evaluate(pr prContext) *Evaluation {
+	title := pr.Title
+	language := c.languageFor(pr.Org, pr.Repo)
+	evaluation := &Evaluation{Verdict: VerdictPass}
+	for _, r := range c.rules {
+		if r.exempts(pr) {
+			evaluation.Exempt = append(evaluation.Exempt, r.name)
+			continue
+		}
+		if r.re.MatchString(title) {
+			continue
+		}
+		evaluation.Failures = append(evaluation.Failures, Failure{
+			Rule:     r.name,
+			Message:  render(c.message(r, language), c.data(pr, r.name, r.re.String())),
+			Severity: r.severity,
+		})
+		if r.severity == SeverityError {
+			evaluation.Verdict = VerdictFail
+		}
+	}
+	if len(evaluation.Failures) > 0 {
+		evaluation.SuggestedTitle = c.suggest(title)
+	}
+	return evaluation
+}
+
+// follows returns true if the title doesn't break any rule.
+func (c *pluginConfig) follows(title string) bool {
+	for _, r := range c.rules {
+		if !r.re.MatchString(title) {
+			return false
+		}
+	}
+	return true
+}
+
+// suggest returns a tidied up version of the title if that one follows the
+// rules, or an empty string otherwise.
+func (c *pluginConfig) suggest(title string) string {
+	tidy := strings.Join(strings.Fields(title), " ")
+	candidates := []string{tidy}
+	if r, size := utf8.DecodeRuneInString(tidy); r != utf8.RuneError {
+		candidates = append(candidates, string(unicode.ToLower(r))+tidy[size:])
+	}
+	for _, candidate := range candidates {
+		if candidate != title && c.follows(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		re    string
+		rules []Rule
+		title string
+
+		expectedErr       error
+		expectedVerdict   string
+		expectedFailures  int
+		expectedSuggested string
+	}{
+		{
+			name:        "not configured",
+			title:       "fix: valid",
+			expectedErr: ErrNotConfigured,
+		},
+		{
+			name:            "valid title",
+			re:              "^(fix:|feat:|major:).*$",
+			title:           "fix: valid",
+			expectedVerdict: VerdictPass,
+		},
+		{
+			name:             "invalid title",
+			re:               "^(fix:|feat:|major:).*$",
+			title:            "this title is wrong",
+			expectedVerdict:  VerdictFail,
+			expectedFailures: 1,
+		},
+		{
+			name:              "invalid title with suggestion",
+			re:                "^(fix:|feat:|major:) [a-z].*$",
+			title:             "  Fix:   it  ",
+			expectedVerdict:   VerdictFail,
+			expectedFailures:  1,
+			expectedSuggested: "fix: it",
+		},
+		{
+			name:             "warning rule broken",
+			re:               "^(fix:|feat:|major:).*$",
+			rules:            []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}},
+			title:            "fix: this title is far too long",
+			expectedVerdict:  VerdictPass,
+			expectedFailures: 1,
+		},
+		{
+			name: "error and notice rules broken",
+			re:   "^(fix:|feat:|major:).*$",
+			rules: []Rule{
+				{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityNotice},
+				{Name: "no-period", Regexp: "^[^.]*$"},
+			},
+			title:            "fix: this title is far too long.",
+			expectedVerdict:  VerdictFail,
+			expectedFailures: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testSubject := &Plugin{}
+			if len(tc.re) > 0 {
+				testSubject.Configure(Settings{Regexp: regexp.MustCompile(tc.re), Rules: tc.rules})
+			}
+			evaluation, err := testSubject.Evaluate("org", "repo", "main", tc.title)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedVerdict, evaluation.Verdict)
+			assert.Len(t, evaluation.Failures, tc.expectedFailures)
+			assert.Equal(t, tc.expectedSuggested, evaluation.SuggestedTitle)
+			assert.Equal(t, PolicyCentralFallback, evaluation.Policy)
+		})
+	}
+}
+
+func TestEvaluateLanguages(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.Configure(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Rules: []Rule{
+			{Name: "length", Regexp: "^.{0,10}$"},
+			{Name: "no-period", Regexp: "^[^.]*$", Message: "No periods in {{.Repo}} titles."},
+		},
+		Languages: map[string]string{"de-org": "de", "org/ja-repo": "ja"},
+		Messages: map[string]Catalogue{
+			"de": {Rules: map[string]string{"no-period": "Keine Punkte in Titeln von {{.Org}}/{{.Repo}}."}},
+		},
+	})
+
+	testCases := []struct {
+		name             string
+		org              string
+		repo             string
+		expectedMessages []string
+	}{
+		{
+			name: "default language",
+			org:  "org",
+			repo: "repo",
+			expectedMessages: []string{
+				"Wrong title for PR, allowed titles need to match the regular expression: ^(fix:|feat:|major:).*$",
+				"The title needs to match the regular expression: ^.{0,10}$",
+				"No periods in repo titles.",
+			},
+		},
+		{
+			name: "org language with translated rule",
+			org:  "de-org",
+			repo: "repo",
+			expectedMessages: []string{
+				"Ungültiger Titel für den PR, erlaubte Titel müssen dem regulären Ausdruck entsprechen: ^(fix:|feat:|major:).*$",
+				"Der Titel muss dem regulären Ausdruck entsprechen: ^.{0,10}$",
+				"Keine Punkte in Titeln von de-org/repo.",
+			},
+		},
+		{
+			name: "repo language without translated rule",
+			org:  "org",
+			repo: "ja-repo",
+			expectedMessages: []string{
+				"PRのタイトルが正しくありません。タイトルは正規表現 ^(fix:|feat:|major:).*$ に一致する必要があります",
+				"タイトルは正規表現 ^.{0,10}$ に一致する必要があります",
+				"No periods in ja-repo titles.",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evaluation, err := testSubject.Evaluate(tc.org, tc.repo, "main", "a title that is too long.")
+			assert.NoError(t, err)
+			var messages []string
+			for _, f := range evaluation.Failures {
+				messages = append(messages, f.Message)
+			}
+			assert.Equal(t, tc.expectedMessages, messages)
+		})
+	}
+}
+
+func TestEvaluateEffectiveFrom(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp:        regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		EffectiveFrom: "2024-01-01",
+		Rules:         []Rule{{Name: "length", Regexp: "^.{0,10}$", EffectiveFrom: "2024-06-01T12:00:00Z"}},
+	})
+
+	testCases := []struct {
+		name      string
+		createdAt time.Time
+
+		expectedVerdict  string
+		expectedFailures []string
+		expectedExempt   []string
+	}{
+		{
+			name:             "no creation time",
+			expectedVerdict:  VerdictFail,
+			expectedFailures: []string{regexpRule, "length"},
+		},
+		{
+			name:            "created before both rules",
+			createdAt:       time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC),
+			expectedVerdict: VerdictPass,
+			expectedExempt:  []string{regexpRule, "length"},
+		},
+		{
+			name:             "created between the rules",
+			createdAt:        time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC),
+			expectedVerdict:  VerdictFail,
+			expectedFailures: []string{regexpRule},
+			expectedExempt:   []string{"length"},
+		},
+		{
+			name:             "created when the rule takes effect",
+			createdAt:        time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectedVerdict:  VerdictFail,
+			expectedFailures: []string{regexpRule, "length"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pr := testPR("this title is wrong")
+			pr.CreatedAt = tc.createdAt
+			evaluation := c.evaluate(pr)
+			assert.Equal(t, tc.expectedVerdict, evaluation.Verdict)
+			var failures []string
+			for _, f := range evaluation.Failures {
+				failures = append(failures, f.Rule)
+			}
+			assert.Equal(t, tc.expectedFailures, failures)
+			assert.Equal(t, tc.expectedExempt, evaluation.Exempt)
+		})
+	}
+}
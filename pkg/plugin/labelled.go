@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/checkpoint"
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// labelledPR is an open PR carrying the "needs-retitle" label.
+type labelledPR struct {
+	pr pullRequest
+	// since is when the label was last added.
+	since time.Time
+}
+
+// labelledPRs searches the open PRs carrying the "needs-retitle" label in
+// the orgs and repos, and works out since when they carry it from their
+// label events. PRs without a labeled event are left out.
+func (p *Plugin) labelledPRs(log *logrus.Entry, ghc githubClient, orgs, repos []string) ([]labelledPR, error) {
+	var found []pullRequest
+	q := Scope{}.baseQuery() + ` label:"` + needsRetitleLabel + `"`
+	if err := searchPartitioned(context.Background(), log, ghc, q, Scope{}.partition(orgs, repos), p.GetScanOptions().MinRateLimit, func(pr pullRequest) {
+		// The search index can lag behind, so the labels are checked again.
+		if pr.hasLabel(needsRetitleLabel) {
+			found = append(found, pr)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	var labelled []labelledPR
+	for _, pr := range found {
+		org, repo, num := string(pr.Repository.Owner.Login), string(pr.Repository.Name), int(pr.Number)
+		since, err := labelledSince(log, ghc, org, repo, num)
+		if err != nil {
+			return nil, err
+		}
+		if since.IsZero() {
+			log.WithFields(logrus.Fields{"org": org, "repo": repo, "pr": num}).Debug("No labeled event found.")
+			continue
+		}
+		labelled = append(labelled, labelledPR{pr: pr, since: since})
+	}
+	return labelled, nil
+}
+
+// labelledSince returns when the "needs-retitle" label was last added to the
+// PR, or the zero time if there is no event for it.
+func labelledSince(log *logrus.Entry, ghc githubClient, org, repo string, num int) (time.Time, error) {
+	var events []github.ListedIssueEvent
+	if err := retry(log, "list_issue_events", func() (err error) {
+		events, err = ghc.ListIssueEvents(org, repo, num)
+		return err
+	}); err != nil {
+		return time.Time{}, err
+	}
+	var since time.Time
+	for _, e := range events {
+		if e.Event == github.IssueActionLabeled && e.Label.Name == needsRetitleLabel && e.CreatedAt.After(since) {
+			since = e.CreatedAt
+		}
+	}
+	return since, nil
+}
+
+// FollowUp takes the escalation steps due for the PRs that have carried the
+// "needs-retitle" label for a while and announces the ones that have carried
+// it for too long, after a periodic pass. Escalation only runs when the
+// central config has steps, and each PR gets the steps of its repo, which
+// its title policy file can change. What was announced is loaded from and
+// saved to the store, if any, so PRs aren't announced again within the
+// window across restarts. In dry run the announcements are only logged and
+// the store isn't updated, and PRs in shadow repos are never announced.
+// Errors escalating single PRs don't stop the others, the last one is
+// returned.
+func (p *Plugin) FollowUp(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, store checkpoint.Store) error {
+	c := p.GetConfig()
+	if c == nil {
+		return nil
+	}
+	notifying := p.notifier != nil && p.notifier.Enabled()
+	if !notifying && len(c.settings.Escalation) == 0 {
+		return nil
+	}
+	log = withScanID(log)
+	orgs, repos := config.EnabledReposForExternalPlugin(PluginName)
+	labelled, err := p.labelledPRs(log, ghc, orgs, repos)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	now := time.Now()
+	for _, l := range labelled {
+		if len(c.settings.Escalation) == 0 {
+			break
+		}
+		// Repos can change or turn off the steps in their title policy file.
+		org, repo, num := string(l.pr.Repository.Owner.Login), string(l.pr.Repository.Name), int(l.pr.Number)
+		ec, err := p.effectiveConfig(log, ghc, org, repo, num, string(l.pr.BaseRefName), string(l.pr.BaseRefOid))
+		if err == nil {
+			_, err = p.escalate(log, ghc, ec, l, now)
+		}
+		if err != nil {
+			log.WithError(err).WithField("pr", num).Error("Error escalating PR.")
+			lastErr = err
+		}
+	}
+	if !notifying {
+		return lastErr
+	}
+
+	prs := make([]notify.PR, 0, len(labelled))
+	for _, l := range labelled {
+		org, repo := string(l.pr.Repository.Owner.Login), string(l.pr.Repository.Name)
+		if c.shadow(org, repo) {
+			continue
+		}
+		prs = append(prs, notify.PR{
+			Org:    org,
+			Repo:   repo,
+			Number: int(l.pr.Number),
+			Title:  string(l.pr.Title),
+			Author: string(l.pr.Author.Login),
+			URL:    string(l.pr.URL),
+			Since:  l.since,
+		})
+	}
+	if store != nil {
+		if cp, err := store.Load(); err != nil {
+			log.WithError(err).Warn("Error loading the announcements, PRs may be announced again.")
+		} else {
+			p.notifier.Restore(cp.Notifications)
+		}
+	}
+	dryRun := p.DryRun()
+	notifyErr := p.notifier.Notify(log, prs, dryRun)
+	if store != nil && !dryRun {
+		// The checkpoint is loaded again, as the scan may have saved it.
+		cp, err := store.Load()
+		if err == nil {
+			cp.Notifications = p.notifier.State()
+			err = store.Save(cp)
+		}
+		if err != nil {
+			log.WithError(err).Error("Error saving the announcements.")
+		}
+	}
+	if notifyErr != nil {
+		return notifyErr
+	}
+	return lastErr
+}
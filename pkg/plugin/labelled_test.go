@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestFollowUpNotifications(t *testing.T) {
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		texts = append(texts, payload.Text)
+	}))
+	defer server.Close()
+
+	testSubject := &Plugin{}
+	testSubject.Configure(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Notifications: notify.Config{
+			MinAge:   "24h",
+			Channels: []notify.Channel{{Name: "team", WebhookURL: server.URL, Repos: []string{"org"}}},
+		},
+	})
+
+	prs := []pullRequest{
+		{Number: 1, Title: "relabelled recently", URL: "https://github.com/org/repo/pull/1"},
+		{Number: 2, Title: "labelled long ago", URL: "https://github.com/org/repo/pull/2"},
+		{Number: 3, Title: "fix: not labelled"},
+	}
+	for i := range prs {
+		prs[i].Repository.Name = "repo"
+		prs[i].Repository.Owner.Login = "org"
+		prs[i].Author.Login = "author"
+		if i < 2 {
+			prs[i].Labels.Nodes = append(prs[i].Labels.Nodes, struct{ Name githubql.String }{Name: needsRetitleLabel})
+		}
+	}
+	longAgo := time.Now().Add(-72 * time.Hour).Truncate(time.Minute).UTC()
+	labelled := func(at time.Time) github.ListedIssueEvent {
+		return github.ListedIssueEvent{Event: github.IssueActionLabeled, Label: github.Label{Name: needsRetitleLabel}, CreatedAt: at}
+	}
+	fake := newFakeClient(prs, nil, nil)
+	fake.events = map[string][]github.ListedIssueEvent{
+		testKey("org", "repo", 1): {
+			labelled(longAgo),
+			{Event: github.IssueActionUnlabeled, Label: github.Label{Name: needsRetitleLabel}, CreatedAt: longAgo.Add(time.Hour)},
+			labelled(time.Now().Add(-time.Hour)),
+		},
+		testKey("org", "repo", 2): {
+			{Event: github.IssueActionLabeled, Label: github.Label{Name: "lgtm"}, CreatedAt: time.Now()},
+			labelled(longAgo),
+		},
+	}
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+
+	store := &memoryStore{}
+	assert.NoError(t, testSubject.FollowUp(logrus.WithField("plugin", PluginName), fake, config, store))
+	assert.Equal(t, []string{"Daily digest: 1 PR(s) have carried the `needs-retitle` label for over 24h0m0s:\n" +
+		"• <https://github.com/org/repo/pull/2|org/repo#2> labelled long ago by author, labelled since " + longAgo.Format("2006-01-02 15:04 MST")}, texts)
+	assert.Equal(t, []string{`archived:false is:pr is:open label:"needs-retitle" org:"org"`}, fake.queries)
+	if assert.NotNil(t, store.c.Notifications) {
+		assert.Contains(t, store.c.Notifications.Announced["team"], "org/repo#2")
+	}
+
+	// In dry run nothing is posted or saved.
+	dryRunStore := &memoryStore{}
+	dryRun := &Plugin{}
+	dryRun.Configure(testSubject.c.settings)
+	dryRun.SetDryRun(true)
+	assert.NoError(t, dryRun.FollowUp(logrus.WithField("plugin", PluginName), fake, config, dryRunStore))
+	assert.Len(t, texts, 1)
+	assert.Nil(t, dryRunStore.c.Notifications)
+
+	// PRs in shadow repos aren't announced.
+	shadowStore := &memoryStore{}
+	shadowed := testSubject.c.settings
+	shadowed.Modes = map[string]string{"org/repo": ModeShadow}
+	shadow := &Plugin{}
+	shadow.Configure(shadowed)
+	assert.NoError(t, shadow.FollowUp(logrus.WithField("plugin", PluginName), fake, config, shadowStore))
+	assert.Len(t, texts, 1)
+	if assert.NotNil(t, shadowStore.c.Notifications) {
+		assert.Empty(t, shadowStore.c.Notifications.Announced)
+	}
+
+	// A restarted plugin doesn't announce the PR again within the window.
+	restarted := &Plugin{}
+	restarted.Configure(testSubject.c.settings)
+	assert.NoError(t, restarted.FollowUp(logrus.WithField("plugin", PluginName), fake, config, store))
+	assert.Len(t, texts, 1)
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"container/list"
+)
+
+// lru holds at most size values by key, evicting the least recently used
+// ones. It isn't safe for concurrent use.
+type lru struct {
+	size int
+	// entries holds the *lruEntry of each key, the most recently used
+	// first, and index maps each key to its element in entries.
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, entries: list.New(), index: map[string]*list.Element{}}
+}
+
+func (c *lru) get(key string) (interface{}, bool) {
+	e, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	c.entries.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lru) put(key string, value interface{}) {
+	if e, ok := c.index[key]; ok {
+		e.Value = &lruEntry{key: key, value: value}
+		c.entries.MoveToFront(e)
+		return
+	}
+	c.index[key] = c.entries.PushFront(&lruEntry{key: key, value: value})
+	for c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lru) remove(key string) {
+	if e, ok := c.index[key]; ok {
+		c.entries.Remove(e)
+		delete(c.index, key)
+	}
+}
@@ -0,0 +1,325 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultLanguage is the language of the messages when none is configured.
+const DefaultLanguage = "en"
+
+// Catalogue holds the messages for a language. Messages are templates that
+// can use the PR context: {{.Org}}, {{.Repo}}, {{.Number}}, {{.Author}},
+// {{.Title}}, {{.BaseBranch}} and {{.DocsURL}}, along with {{.Rule}} and
+// {{.Regexp}} for the rule broken.
+type Catalogue struct {
+	// ErrorMessage is the message for the "regexp" rule.
+	ErrorMessage string `json:"error_message,omitempty"`
+	// Rules are the messages for the other rules, keyed by rule name.
+	Rules map[string]string `json:"rules,omitempty"`
+	// RulesHeader introduces the table of rules broken in comments.
+	RulesHeader string `json:"rules_header,omitempty"`
+	// RuleMessage is the message for rules without one.
+	RuleMessage string `json:"rule_message,omitempty"`
+	// RuleColumn, SeverityColumn and ReasonColumn are the column headers of
+	// the table of rules broken in comments, PatternColumn introduces the
+	// pattern of each rule in the collapsible block.
+	RuleColumn     string `json:"rule_column,omitempty"`
+	SeverityColumn string `json:"severity_column,omitempty"`
+	ReasonColumn   string `json:"reason_column,omitempty"`
+	PatternColumn  string `json:"pattern_column,omitempty"`
+	// Reason is the reason in comments for the rules broken whose message
+	// is a built-in one, as those show the pattern, which comments only
+	// show in the collapsible block.
+	Reason string `json:"reason,omitempty"`
+	// ErrorSeverity and WarningSeverity are the severities of the rules
+	// broken in comments. Notices aren't commented on.
+	ErrorSeverity   string `json:"error_severity,omitempty"`
+	WarningSeverity string `json:"warning_severity,omitempty"`
+	// ExamplesHeader introduces the example titles in comments.
+	ExamplesHeader string `json:"examples_header,omitempty"`
+	// DocsLink points to the docs in comments.
+	DocsLink string `json:"docs_link,omitempty"`
+	// DetailsSummary is the summary of the collapsible block with the
+	// patterns of the rules in comments.
+	DetailsSummary string `json:"details_summary,omitempty"`
+	// RemindMessage, AttentionMessage and CloseMessage are the comments of
+	// the escalation steps without a message. {{.Mentions}} holds the
+	// assignees and reviewers to mention.
+	RemindMessage    string `json:"remind_message,omitempty"`
+	AttentionMessage string `json:"attention_message,omitempty"`
+	CloseMessage     string `json:"close_message,omitempty"`
+}
+
+// builtinCatalogues are the translations of the default messages.
+var builtinCatalogues = map[string]Catalogue{
+	"en": {
+		ErrorMessage:    "Wrong title for PR, allowed titles need to match the regular expression: {{.Regexp}}",
+		RuleMessage:     "The title needs to match the regular expression: {{.Regexp}}",
+		RulesHeader:     "The title breaks these rules:",
+		RuleColumn:      "Rule",
+		SeverityColumn:  "Severity",
+		ReasonColumn:    "Reason",
+		PatternColumn:   "Pattern",
+		Reason:          "The title doesn't match the pattern of the rule.",
+		ErrorSeverity:   "error",
+		WarningSeverity: "warning",
+		ExamplesHeader:  "Titles like these follow the rules:",
+		DocsLink:        "See the [contribution guide]({{.DocsURL}}) for more about titles.",
+		DetailsSummary:  "Patterns of the rules",
+
+		RemindMessage:    "@{{.Author}}, this PR still carries the `needs-retitle` label. Please update its title so it can be merged.",
+		AttentionMessage: "{{if .Mentions}}{{.Mentions}}: {{end}}this PR has carried the `needs-retitle` label for a while, could you help @{{.Author}} fix its title?",
+		CloseMessage:     "@{{.Author}}, this PR is being closed because its title still doesn't follow the rules. Feel free to reopen it once the title is fixed.",
+	},
+	"de": {
+		ErrorMessage:    "Ungültiger Titel für den PR, erlaubte Titel müssen dem regulären Ausdruck entsprechen: {{.Regexp}}",
+		RuleMessage:     "Der Titel muss dem regulären Ausdruck entsprechen: {{.Regexp}}",
+		RulesHeader:     "Der Titel verstößt gegen diese Regeln:",
+		RuleColumn:      "Regel",
+		SeverityColumn:  "Schweregrad",
+		ReasonColumn:    "Grund",
+		PatternColumn:   "Muster",
+		Reason:          "Der Titel entspricht nicht dem Muster der Regel.",
+		ErrorSeverity:   "Fehler",
+		WarningSeverity: "Warnung",
+		ExamplesHeader:  "Titel wie diese entsprechen den Regeln:",
+		DocsLink:        "Mehr zu Titeln steht im [Leitfaden für Beiträge]({{.DocsURL}}).",
+		DetailsSummary:  "Muster der Regeln",
+
+		RemindMessage:    "@{{.Author}}, dieser PR hat immer noch das Label `needs-retitle`. Bitte passe den Titel an, damit er gemergt werden kann.",
+		AttentionMessage: "{{if .Mentions}}{{.Mentions}}: {{end}}dieser PR hat seit einer Weile das Label `needs-retitle`, könnt ihr @{{.Author}} helfen, den Titel zu korrigieren?",
+		CloseMessage:     "@{{.Author}}, dieser PR wird geschlossen, weil sein Titel immer noch nicht den Regeln entspricht. Öffne ihn gerne wieder, sobald der Titel korrigiert ist.",
+	},
+	"ja": {
+		ErrorMessage:    "PRのタイトルが正しくありません。タイトルは正規表現 {{.Regexp}} に一致する必要があります",
+		RuleMessage:     "タイトルは正規表現 {{.Regexp}} に一致する必要があります",
+		RulesHeader:     "タイトルが次のルールに違反しています:",
+		RuleColumn:      "ルール",
+		SeverityColumn:  "重大度",
+		ReasonColumn:    "理由",
+		PatternColumn:   "パターン",
+		Reason:          "タイトルがルールのパターンに一致しません。",
+		ErrorSeverity:   "エラー",
+		WarningSeverity: "警告",
+		ExamplesHeader:  "次のようなタイトルはルールに従っています:",
+		DocsLink:        "タイトルについては[コントリビューションガイド]({{.DocsURL}})を参照してください。",
+		DetailsSummary:  "ルールのパターン",
+
+		RemindMessage:    "@{{.Author}} さん、このPRにはまだ `needs-retitle` ラベルが付いています。マージできるようにタイトルを修正してください。",
+		AttentionMessage: "{{if .Mentions}}{{.Mentions}} {{end}}このPRにはしばらく `needs-retitle` ラベルが付いています。@{{.Author}} さんのタイトル修正を手伝ってもらえますか?",
+		CloseMessage:     "@{{.Author}} さん、タイトルがルールに従っていないため、このPRをクローズします。タイトルを修正したら再オープンしてください。",
+	},
+}
+
+// messageData is what message templates are executed with.
+type messageData struct {
+	Org        string
+	Repo       string
+	Number     int
+	Author     string
+	Title      string
+	BaseBranch string
+	DocsURL    string
+	Rule       string
+	Regexp     string
+	Mentions   string
+}
+
+// prContext is the PR a title is evaluated for. Fields other than Title can
+// be empty when the title isn't evaluated for an actual PR.
+type prContext struct {
+	Org        string
+	Repo       string
+	Number     int
+	Author     string
+	Title      string
+	BaseBranch string
+	// CreatedAt is when the PR was created, rules that took effect later
+	// don't apply to it.
+	CreatedAt time.Time
+}
+
+// data returns what message templates about the rule are executed with for
+// the PR.
+func (c *pluginConfig) data(pr prContext, rule, re string) messageData {
+	return messageData{
+		Org:        pr.Org,
+		Repo:       pr.Repo,
+		Number:     pr.Number,
+		Author:     pr.Author,
+		Title:      pr.Title,
+		BaseBranch: pr.BaseBranch,
+		DocsURL:    c.settings.DocsURL,
+		Rule:       rule,
+		Regexp:     re,
+	}
+}
+
+// render executes the message template with the data. Messages that aren't
+// valid templates are returned as they are.
+func render(message string, data messageData) string {
+	t, err := template.New("message").Option("missingkey=error").Parse(message)
+	if err != nil {
+		return message
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return message
+	}
+	return b.String()
+}
+
+// Languages returns the languages with built-in messages.
+func Languages() []string {
+	var languages []string
+	for language := range builtinCatalogues {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// ValidateMessage checks the message is a template that can be executed with
+// the PR context.
+func ValidateMessage(message string) error {
+	t, err := template.New("message").Option("missingkey=error").Parse(message)
+	if err != nil {
+		return err
+	}
+	return t.Execute(&strings.Builder{}, messageData{})
+}
+
+// ValidateLanguage checks there are messages in the language, either built in
+// or in the catalogues.
+func ValidateLanguage(language string, catalogues map[string]Catalogue) error {
+	if len(language) == 0 {
+		return nil
+	}
+	if _, ok := builtinCatalogues[language]; ok {
+		return nil
+	}
+	if _, ok := catalogues[language]; ok {
+		return nil
+	}
+	return fmt.Errorf("no messages for language %q, built-in languages are %s", language, strings.Join(Languages(), ", "))
+}
+
+// ValidateCatalogues checks the messages in the catalogues are valid
+// templates.
+func ValidateCatalogues(catalogues map[string]Catalogue) error {
+	languages := make([]string, 0, len(catalogues))
+	for language := range catalogues {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		c := catalogues[language]
+		messages := map[string]string{
+			"error_message":     c.ErrorMessage,
+			"rules_header":      c.RulesHeader,
+			"rule_message":      c.RuleMessage,
+			"rule_column":       c.RuleColumn,
+			"severity_column":   c.SeverityColumn,
+			"reason_column":     c.ReasonColumn,
+			"pattern_column":    c.PatternColumn,
+			"reason":            c.Reason,
+			"error_severity":    c.ErrorSeverity,
+			"warning_severity":  c.WarningSeverity,
+			"examples_header":   c.ExamplesHeader,
+			"docs_link":         c.DocsLink,
+			"details_summary":   c.DetailsSummary,
+			"remind_message":    c.RemindMessage,
+			"attention_message": c.AttentionMessage,
+			"close_message":     c.CloseMessage,
+		}
+		for name, message := range c.Rules {
+			messages["rules."+name] = message
+		}
+		keys := make([]string, 0, len(messages))
+		for key := range messages {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := ValidateMessage(messages[key]); err != nil {
+				return fmt.Errorf("%s.%s: %v", language, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LanguageFor returns the language of the messages for org/repo: the one set
+// for the repo, then the one set for the org, then Language, English if none
+// is set.
+func (s Settings) LanguageFor(org, repo string) string {
+	if language, ok := s.Languages[org+"/"+repo]; ok {
+		return language
+	}
+	if language, ok := s.Languages[org]; ok {
+		return language
+	}
+	if len(s.Language) > 0 {
+		return s.Language
+	}
+	return DefaultLanguage
+}
+
+// languageFor returns the language of the messages for org/repo.
+func (c *pluginConfig) languageFor(org, repo string) string {
+	return c.settings.LanguageFor(org, repo)
+}
+
+// message returns the message template for the rule in the language. The
+// message configured for the language comes first, then the untranslated
+// one from the config, then the built-in one.
+func (c *pluginConfig) message(r rule, language string) string {
+	if m := c.configuredMessage(r, language); len(m) > 0 {
+		return m
+	}
+	if r.name == regexpRule {
+		return c.builtin(language).ErrorMessage
+	}
+	return c.builtin(language).RuleMessage
+}
+
+// configuredMessage returns the message template for the rule in the
+// language set in the config, or an empty string if the built-in one is
+// used.
+func (c *pluginConfig) configuredMessage(r rule, language string) string {
+	configured := c.settings.Messages[language]
+	if r.name == regexpRule {
+		if len(configured.ErrorMessage) > 0 {
+			return configured.ErrorMessage
+		}
+	} else if m, ok := configured.Rules[r.name]; ok && len(m) > 0 {
+		return m
+	}
+	if len(r.message) > 0 {
+		return r.message
+	}
+	if r.name != regexpRule {
+		return configured.RuleMessage
+	}
+	return ""
+}
+
+// text returns the message picked by field from the catalogue for the
+// language, or from the built-in one if it isn't configured.
+func (c *pluginConfig) text(language string, field func(Catalogue) string) string {
+	if t := field(c.settings.Messages[language]); len(t) > 0 {
+		return t
+	}
+	return field(c.builtin(language))
+}
+
+func (c *pluginConfig) builtin(language string) Catalogue {
+	if builtin, ok := builtinCatalogues[language]; ok {
+		return builtin
+	}
+	return builtinCatalogues[DefaultLanguage]
+}
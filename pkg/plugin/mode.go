@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ModeEnforce changes PRs to match their evaluation, the default.
+	ModeEnforce = "enforce"
+	// ModeShadow evaluates PRs and records what would change in the
+	// metrics, the audit log and the plans, without changing them.
+	ModeShadow = "shadow"
+)
+
+// Modes are the valid modes.
+var Modes = []string{ModeEnforce, ModeShadow}
+
+// ValidateMode checks the mode is empty or one of Modes.
+func ValidateMode(mode string) error {
+	if len(mode) == 0 {
+		return nil
+	}
+	for _, m := range Modes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid mode %q, valid modes are %s", mode, strings.Join(Modes, ", "))
+}
+
+// ModeFor returns the mode of org/repo: the one set for the repo, then the
+// one set for the org, then Mode, enforce if none is set.
+func (s Settings) ModeFor(org, repo string) string {
+	if mode, ok := s.Modes[org+"/"+repo]; ok && len(mode) > 0 {
+		return mode
+	}
+	if mode, ok := s.Modes[org]; ok && len(mode) > 0 {
+		return mode
+	}
+	if len(s.Mode) > 0 {
+		return s.Mode
+	}
+	return ModeEnforce
+}
+
+// shadow returns true if PRs in org/repo are only evaluated, not changed.
+func (c *pluginConfig) shadow(org, repo string) bool {
+	return c.settings.ModeFor(org, repo) == ModeShadow
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeFor(t *testing.T) {
+	s := Settings{Mode: ModeShadow, Modes: map[string]string{"org": ModeEnforce, "org/shadow": ModeShadow}}
+	assert.Equal(t, ModeEnforce, s.ModeFor("org", "repo"))
+	assert.Equal(t, ModeShadow, s.ModeFor("org", "shadow"))
+	assert.Equal(t, ModeShadow, s.ModeFor("other", "repo"))
+	assert.Equal(t, ModeEnforce, Settings{}.ModeFor("other", "repo"))
+}
+
+func TestTakeActionShadow(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Modes:  map[string]string{"org/shadow": ModeShadow},
+	})
+	sink := &memSink{}
+	testSubject := &Plugin{c: c}
+	testSubject.SetAuditSink(sink)
+	log := logrus.WithField("plugin", PluginName)
+
+	// PRs in shadow repos are evaluated and recorded, not changed.
+	pr := testPR("bad title")
+	pr.Repo = "shadow"
+	key := testKey("org", "shadow", 1)
+	before := testutil.ToFloat64(metrics.ShadowActions.WithLabelValues("org/shadow", string(ActionAddLabel)))
+	fake := newFakeClient(nil, nil, nil)
+	actions, err := testSubject.takeAction(log, fake, pr, nil, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Org: "org", Repo: "shadow", Number: 1, Type: ActionAddLabel, Label: needsRetitleLabel},
+		{Org: "org", Repo: "shadow", Number: 1, Type: ActionCreateComment},
+	}, actions)
+	assert.False(t, fake.commentCreated[key])
+	assert.Empty(t, fake.IssueLabelsAdded[key])
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.ShadowActions.WithLabelValues("org/shadow", string(ActionAddLabel))))
+	if assert.Len(t, sink.records, 2) {
+		assert.True(t, sink.records[0].Shadow)
+		assert.True(t, sink.records[0].DryRun)
+	}
+	if plans := testSubject.Plans(Scope{}, time.Time{}); assert.Len(t, plans, 1) {
+		assert.True(t, plans[0].Shadow)
+	}
+
+	// Enforced repos keep working normally.
+	sink.records = nil
+	key = testKey("org", "repo", 1)
+	fake = newFakeClient(nil, nil, nil)
+	_, err = testSubject.takeAction(log, fake, testPR("bad title"), nil, c)
+	assert.NoError(t, err)
+	assert.True(t, fake.commentCreated[key])
+	assert.Equal(t, []string{needsRetitleLabel}, fake.IssueLabelsAdded[key])
+	if assert.Len(t, sink.records, 2) {
+		assert.False(t, sink.records[0].Shadow)
+		assert.False(t, sink.records[0].DryRun)
+	}
+	assert.Len(t, testSubject.Plans(Scope{}, time.Time{}), 1)
+}
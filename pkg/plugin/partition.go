@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// searchLimit is the maximum number of results GitHub returns for a
+	// search, any result past it is silently dropped.
+	searchLimit = 1000
+	// minPartitionWindow is the shortest creation date window a partition
+	// is split into. Partitions with a shorter window are searched even if
+	// the results are truncated.
+	minPartitionWindow = time.Hour
+)
+
+// searchEpoch is earlier than the creation date of any PR.
+var searchEpoch = time.Date(2008, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var errTooManyResults = errors.New("too many search results")
+
+// partition is a part of a search, covering some orgs and repos and,
+// optionally, a window of PR creation dates.
+type partition struct {
+	orgs  []string
+	repos []string
+	// createdFrom and createdTo limit the partition to the PRs created
+	// within that window, both inclusive, when set.
+	createdFrom, createdTo time.Time
+}
+
+func (pt partition) hasWindow() bool {
+	return !pt.createdTo.IsZero()
+}
+
+// query returns the search query for the partition, adding its qualifiers to
+// base.
+func (pt partition) query(base string) string {
+	var buf bytes.Buffer
+	buf.WriteString(base)
+	for _, org := range pt.orgs {
+		fmt.Fprintf(&buf, " org:\"%s\"", org)
+	}
+	for _, repo := range pt.repos {
+		fmt.Fprintf(&buf, " repo:\"%s\"", repo)
+	}
+	if pt.hasWindow() {
+		fmt.Fprintf(&buf, " created:%s..%s", pt.createdFrom.UTC().Format(time.RFC3339), pt.createdTo.UTC().Format(time.RFC3339))
+	}
+	return buf.String()
+}
+
+// canSplit returns true if the partition can be split into smaller ones.
+func (pt partition) canSplit() bool {
+	if len(pt.orgs)+len(pt.repos) > 1 || len(pt.orgs) == 1 || !pt.hasWindow() {
+		return true
+	}
+	return pt.createdTo.Sub(pt.createdFrom) > minPartitionWindow
+}
+
+// split splits the partition by org and repo first, then by repo for each
+// org, and finally in halves of its creation date window.
+func (pt partition) split(ghc githubClient) ([]partition, error) {
+	switch {
+	case len(pt.orgs)+len(pt.repos) > 1:
+		orgs := map[string]bool{}
+		var parts []partition
+		for _, org := range pt.orgs {
+			orgs[org] = true
+			parts = append(parts, partition{orgs: []string{org}})
+		}
+		for _, repo := range pt.repos {
+			// The repos of split orgs are already covered.
+			if i := strings.Index(repo, "/"); i > 0 && orgs[repo[:i]] {
+				continue
+			}
+			parts = append(parts, partition{repos: []string{repo}})
+		}
+		return parts, nil
+	case len(pt.orgs) == 1:
+		repos, err := ghc.GetRepos(pt.orgs[0], false)
+		if err != nil {
+			// Owners enabling the plugin can be users rather than orgs.
+			var userErr error
+			if repos, userErr = ghc.GetRepos(pt.orgs[0], true); userErr != nil {
+				metrics.GitHubErrors.WithLabelValues("get_repos").Inc()
+				return nil, err
+			}
+		}
+		var parts []partition
+		for _, repo := range repos {
+			if repo.Archived {
+				continue
+			}
+			parts = append(parts, partition{repos: []string{pt.orgs[0] + "/" + repo.Name}})
+		}
+		return parts, nil
+	case !pt.hasWindow():
+		whole := partition{repos: pt.repos, createdFrom: searchEpoch, createdTo: time.Now().UTC().Truncate(time.Second)}
+		return whole.split(ghc)
+	default:
+		mid := pt.createdFrom.Add(pt.createdTo.Sub(pt.createdFrom) / 2).Truncate(time.Second)
+		return []partition{
+			{repos: pt.repos, createdFrom: pt.createdFrom, createdTo: mid},
+			{repos: pt.repos, createdFrom: mid.Add(time.Second), createdTo: pt.createdTo},
+		}, nil
+	}
+}
+
+// searchPartitioned passes the PRs matching base within the partition to fn
+// as they come in. Partitions matching more PRs than GitHub returns for a
+// search are split into smaller ones, until they can't be split anymore.
+func searchPartitioned(ctx context.Context, log *logrus.Entry, ghc githubClient, base string, pt partition, minRateLimit int, fn func(pullRequest)) error {
+	limit := 0
+	if pt.canSplit() {
+		limit = searchLimit
+	}
+	q := pt.query(base)
+	total, err := search(ctx, log, ghc, q, minRateLimit, limit, fn)
+	if !errors.Is(err, errTooManyResults) {
+		return err
+	}
+
+	parts, err := pt.split(ghc)
+	if err != nil {
+		return err
+	}
+	log.Infof("Query \"%s\" matches %d PRs, splitting it in %d searches.", q, total, len(parts))
+	for _, part := range parts {
+		if err := searchPartitioned(ctx, log, ghc, base, part, minRateLimit, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+type searchablePR struct {
+	org, repo string
+	number    int
+	created   time.Time
+}
+
+// searchClient answers search queries filtering by org, repo and creation
+// date, and truncates the results like GitHub does.
+type searchClient struct {
+	*fghc
+	prs       []searchablePR
+	repos     map[string][]github.Repo
+	userRepos map[string][]github.Repo
+}
+
+var (
+	orgQualifier     = regexp.MustCompile(`org:"([^"]+)"`)
+	repoQualifier    = regexp.MustCompile(`repo:"([^"]+)"`)
+	createdQualifier = regexp.MustCompile(`created:(\S+)\.\.(\S+)`)
+)
+
+func (c *searchClient) GetRepos(org string, isUser bool) ([]github.Repo, error) {
+	if isUser {
+		return c.userRepos[org], nil
+	}
+	if _, ok := c.userRepos[org]; ok {
+		return nil, errors.New("status code 404 not one of [200], body: Not Found")
+	}
+	return c.repos[org], nil
+}
+
+func (c *searchClient) QueryWithGitHubAppsSupport(_ context.Context, q interface{}, vars map[string]interface{}, _ string) error {
+	query, ok := q.(*searchQuery)
+	if !ok {
+		return errors.New("invalid query format")
+	}
+	qs := string(vars["query"].(githubql.String))
+	c.queries = append(c.queries, qs)
+
+	orgs := map[string]bool{}
+	for _, m := range orgQualifier.FindAllStringSubmatch(qs, -1) {
+		orgs[m[1]] = true
+	}
+	repos := map[string]bool{}
+	for _, m := range repoQualifier.FindAllStringSubmatch(qs, -1) {
+		repos[m[1]] = true
+	}
+	var from, to time.Time
+	if m := createdQualifier.FindStringSubmatch(qs); m != nil {
+		from, _ = time.Parse(time.RFC3339, m[1])
+		to, _ = time.Parse(time.RFC3339, m[2])
+	}
+
+	var matches []searchablePR
+	for _, pr := range c.prs {
+		if !orgs[pr.org] && !repos[pr.org+"/"+pr.repo] {
+			continue
+		}
+		if !to.IsZero() && (pr.created.Before(from) || pr.created.After(to)) {
+			continue
+		}
+		matches = append(matches, pr)
+	}
+	query.Search.IssueCount = githubql.Int(len(matches))
+	if len(matches) > searchLimit {
+		matches = matches[:searchLimit]
+	}
+
+	offset := 0
+	if cursor, ok := vars["searchCursor"].(*githubql.String); ok && cursor != nil {
+		offset, _ = strconv.Atoi(string(*cursor))
+	}
+	end := offset + 100
+	if end > len(matches) {
+		end = len(matches)
+	}
+	for _, pr := range matches[offset:end] {
+		n := struct {
+			PullRequest pullRequest `graphql:"... on PullRequest"`
+		}{}
+		n.PullRequest.Number = githubql.Int(pr.number)
+		n.PullRequest.Repository.Name = githubql.String(pr.repo)
+		n.PullRequest.Repository.Owner.Login = githubql.String(pr.org)
+		query.Search.Nodes = append(query.Search.Nodes, n)
+	}
+	query.Search.PageInfo.HasNextPage = githubql.Boolean(end < len(matches))
+	query.Search.PageInfo.EndCursor = githubql.String(strconv.Itoa(end))
+	return nil
+}
+
+func TestSearchPartitioned(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var prs []searchablePR
+	for i := 0; i < 2500; i++ {
+		prs = append(prs, searchablePR{org: "org", repo: "big", number: i, created: start.Add(time.Duration(i) * time.Hour)})
+	}
+	for i := 0; i < 10; i++ {
+		prs = append(prs, searchablePR{org: "org", repo: "small", number: i, created: start})
+	}
+	for i := 0; i < 10; i++ {
+		prs = append(prs, searchablePR{org: "org", repo: "archived", number: i, created: start})
+	}
+	for i := 0; i < 5; i++ {
+		prs = append(prs, searchablePR{org: "other", repo: "repo", number: i, created: start})
+	}
+	for i := 0; i < 1200; i++ {
+		prs = append(prs, searchablePR{org: "busy", repo: "repo", number: i, created: start})
+	}
+	for i := 0; i < 1100; i++ {
+		prs = append(prs, searchablePR{org: "user", repo: "project", number: i, created: start.Add(time.Duration(i) * time.Hour)})
+	}
+	repos := map[string][]github.Repo{
+		"org": {{Name: "big"}, {Name: "small"}, {Name: "archived", Archived: true}},
+	}
+	userRepos := map[string][]github.Repo{
+		"user": {{Name: "project"}},
+	}
+
+	testCases := []struct {
+		name string
+		pt   partition
+
+		expectedCount   int
+		expectedQueries []string
+	}{
+		{
+			name:            "under the limit",
+			pt:              partition{orgs: []string{"other"}},
+			expectedCount:   5,
+			expectedQueries: []string{`is:pr org:"other"`},
+		},
+		{
+			name:          "split by org, repo and creation date",
+			pt:            partition{orgs: []string{"org"}, repos: []string{"org/small", "other/repo"}},
+			expectedCount: 2515,
+			expectedQueries: []string{
+				`is:pr org:"org" repo:"org/small" repo:"other/repo"`,
+				`is:pr org:"org"`,
+				`is:pr repo:"org/big"`,
+				`is:pr repo:"org/big" created:2008-01-01T00:00:00Z..`,
+				`is:pr repo:"org/small"`,
+				`is:pr repo:"other/repo"`,
+			},
+		},
+		{
+			name:          "split by the repos of a user",
+			pt:            partition{orgs: []string{"user"}},
+			expectedCount: 1100,
+			expectedQueries: []string{
+				`is:pr org:"user"`,
+				`is:pr repo:"user/project"`,
+				`is:pr repo:"user/project" created:2008-01-01T00:00:00Z..`,
+			},
+		},
+		{
+			name:          "truncated partition",
+			pt:            partition{repos: []string{"busy/repo"}},
+			expectedCount: searchLimit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &searchClient{fghc: newFakeClient(nil, nil, nil), prs: prs, repos: repos, userRepos: userRepos}
+			seen := map[string]bool{}
+			count := 0
+			err := searchPartitioned(context.Background(), logrus.WithField("plugin", PluginName), fake, "is:pr", tc.pt, 0, func(pr pullRequest) {
+				key := testKey(string(pr.Repository.Owner.Login), string(pr.Repository.Name), int(pr.Number))
+				assert.False(t, seen[key], "%s found twice", key)
+				seen[key] = true
+				count++
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCount, count)
+			for _, expected := range tc.expectedQueries {
+				found := false
+				for _, q := range fake.queries {
+					if len(q) >= len(expected) && q[:len(expected)] == expected {
+						found = true
+						break
+					}
+				}
+				assert.True(t, found, "expected a query starting with %q in %q", expected, fake.queries)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Plan is what the plugin would do to a PR in dry run or in shadow mode:
+// the state it wants the PR in, the state the PR is in and the actions that
+// would get it there.
+type Plan struct {
+	Time    time.Time `json:"time"`
+	Org     string    `json:"org"`
+	Repo    string    `json:"repo"`
+	Number  int       `json:"number"`
+	Title   string    `json:"title"`
+	Verdict string    `json:"verdict"`
+	// Shadow is set when the repo of the PR is in shadow mode.
+	Shadow bool `json:"shadow,omitempty"`
+	// Labels are the labels managed by the plugin.
+	Labels  []LabelState `json:"labels"`
+	Comment CommentState `json:"comment"`
+	Actions []Action     `json:"actions"`
+}
+
+// LabelState is whether the PR should carry a label, and whether it does.
+type LabelState struct {
+	Label   string `json:"label"`
+	Desired bool   `json:"desired"`
+	Actual  bool   `json:"actual"`
+}
+
+// CommentState is the comment of the plugin the PR should have, empty if
+// none, and the ones it has.
+type CommentState struct {
+	Desired string   `json:"desired,omitempty"`
+	Actual  []string `json:"actual,omitempty"`
+}
+
+// SetDryRun sets whether the plugin only plans the changes to PRs instead
+// of making them.
+func (p *Plugin) SetDryRun(dryRun bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.dryRun = dryRun
+}
+
+// DryRun returns true if the plugin only plans the changes to PRs.
+func (p *Plugin) DryRun() bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.dryRun
+}
+
+// recordPlan logs the plan and keeps it as the latest one for the PR.
+func (p *Plugin) recordPlan(log *logrus.Entry, plan Plan) {
+	log.WithField("plan", plan).Info("Planned changes to PR.")
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.plans == nil {
+		p.plans = map[string]Plan{}
+	}
+	p.plans[planKey(plan.Org, plan.Repo, plan.Number)] = plan
+}
+
+// Plans returns the latest plan of each PR within the scope made since
+// then, sorted by repo and number.
+func (p *Plugin) Plans(scope Scope, since time.Time) []Plan {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	plans := []Plan{}
+	for _, plan := range p.plans {
+		if plan.Time.Before(since) || !scope.covers(plan.Org, plan.Repo, plan.Number) {
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		a, b := plans[i], plans[j]
+		if a.Org+"/"+a.Repo != b.Org+"/"+b.Repo {
+			return a.Org+"/"+a.Repo < b.Org+"/"+b.Repo
+		}
+		return a.Number < b.Number
+	})
+	return plans
+}
+
+// forgetPlans drops the plans made before then, once a scan of every PR
+// made newer ones for the PRs that are still open.
+func (p *Plugin) forgetPlans(before time.Time) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for key, plan := range p.plans {
+		if plan.Time.Before(before) {
+			delete(p.plans, key)
+		}
+	}
+}
+
+func planKey(org, repo string, num int) string {
+	return fmt.Sprintf("%s/%s#%d", org, repo, num)
+}
+
+// covers returns true if the PR is within the scope, ignoring when it was
+// updated.
+func (s Scope) covers(org, repo string, num int) bool {
+	return (len(s.Org) == 0 || s.Org == org) &&
+		(len(s.Repo) == 0 || s.Repo == repo) &&
+		(s.Number == 0 || s.Number == num)
+}
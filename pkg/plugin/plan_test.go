@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestTakeActionDryRun(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp:       regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Rules:        []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}},
+		WarningLabel: "title/warning",
+	})
+	testSubject := &Plugin{c: c}
+	testSubject.SetDryRun(true)
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+
+	// A failing title plans the comment and the label without making them.
+	fake := newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{{ID: 1, User: github.User{Login: "someone"}, Body: "LGTM"}}
+	pr := testPR("bad title")
+	actions, err := testSubject.takeAction(log, fake, pr, []string{"title/warning"}, c)
+	assert.NoError(t, err)
+	expectedActions := []Action{
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionAddLabel, Label: needsRetitleLabel},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionCreateComment},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionRemoveLabel, Label: "title/warning"},
+	}
+	assert.Equal(t, expectedActions, actions)
+	assert.False(t, fake.commentCreated[key])
+	assert.Empty(t, fake.IssueLabelsAdded[key])
+	assert.Empty(t, fake.IssueLabelsRemoved[key])
+
+	plans := testSubject.Plans(Scope{}, time.Time{})
+	if assert.Len(t, plans, 1) {
+		plan := plans[0]
+		assert.Equal(t, "bad title", plan.Title)
+		assert.Equal(t, VerdictFail, plan.Verdict)
+		assert.Equal(t, []LabelState{
+			{Label: needsRetitleLabel, Desired: true, Actual: false},
+			{Label: "title/warning", Desired: false, Actual: true},
+		}, plan.Labels)
+		assert.Equal(t, c.notice(pr, c.evaluate(pr)), plan.Comment.Desired)
+		assert.Empty(t, plan.Comment.Actual)
+		assert.Equal(t, expectedActions, plan.Actions)
+	}
+
+	// A PR already in the desired state gets a plan without actions.
+	testSubject.comments.forget("org", "repo", 1)
+	fake = newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: c.notice(pr, c.evaluate(pr))}}
+	actions, err = testSubject.takeAction(log, fake, pr, []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	plans = testSubject.Plans(Scope{Org: "org", Repo: "repo", Number: 1}, time.Time{})
+	if assert.Len(t, plans, 1) {
+		assert.Empty(t, plans[0].Actions)
+		assert.Equal(t, []string{c.notice(pr, c.evaluate(pr))}, plans[0].Comment.Actual)
+	}
+	assert.Empty(t, testSubject.Plans(Scope{Org: "other"}, time.Time{}))
+	assert.Empty(t, testSubject.Plans(Scope{}, time.Now().Add(time.Minute)))
+
+	testSubject.forgetPlans(time.Now().Add(time.Minute))
+	assert.Empty(t, testSubject.Plans(Scope{}, time.Time{}))
+}
+
+func TestHandleSearchResultLeavesLabel(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Modes:  map[string]string{"org/shadow": ModeShadow},
+	})
+	log := logrus.WithField("plugin", PluginName)
+	searchResult := func(repo, title string, labels ...string) pullRequest {
+		pr := pullRequest{Number: 1, Title: githubql.String(title)}
+		pr.Repository.Name = githubql.String(repo)
+		pr.Repository.Owner.Login = "org"
+		for _, label := range labels {
+			pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{Name: githubql.String(label)})
+		}
+		return pr
+	}
+
+	var testcases = []struct {
+		name     string
+		dryRun   bool
+		pr       pullRequest
+		labelled bool
+	}{
+		{
+			name:     "dry run doesn't add the label",
+			dryRun:   true,
+			pr:       searchResult("repo", "bad title"),
+			labelled: false,
+		},
+		{
+			name:     "dry run doesn't remove the label",
+			dryRun:   true,
+			pr:       searchResult("repo", "fix: good title", needsRetitleLabel),
+			labelled: true,
+		},
+		{
+			name:     "shadow mode doesn't add the label",
+			pr:       searchResult("shadow", "bad title"),
+			labelled: false,
+		},
+		{
+			name:     "enforced repos get the label",
+			pr:       searchResult("repo", "bad title"),
+			labelled: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			testSubject := &Plugin{c: c}
+			testSubject.SetDryRun(tc.dryRun)
+			_, labelled, err := testSubject.handleSearchResult(log, newFakeClient(nil, nil, nil), tc.pr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.labelled, labelled)
+		})
+	}
+}
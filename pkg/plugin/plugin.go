@@ -17,7 +17,6 @@ limitations under the License.
 package plugin
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"regexp"
@@ -25,6 +24,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ouzi-dev/needs-retitle/pkg/audit"
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
 
@@ -52,16 +54,45 @@ type githubClient interface {
 	DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error
 	QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	GetRepos(org string, isUser bool) ([]github.Repo, error)
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+	ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error)
+	ClosePR(org, repo string, number int) error
 }
 
 type Plugin struct {
-	mut sync.Mutex
-	c   *pluginConfig
+	mut      sync.Mutex
+	c        *pluginConfig
+	opts     ScanOptions
+	lastScan time.Time
+
+	// scanMut is held while a scan is running
+	scanMut sync.Mutex
+
+	repoConfigs repoConfigCache
+	comments    commentCache
+	notifier    *notify.Notifier
+
+	// dryRun is set when changes to PRs are only planned, plans holds the
+	// latest plan of each PR keyed by org/repo#number.
+	dryRun bool
+	plans  map[string]Plan
+
+	auditSink audit.Sink
 }
 
 type pluginConfig struct {
+	// errorMessage and re are the message and the regular expression of
+	// the "regexp" rule.
 	errorMessage string
 	re           *regexp.Regexp
+	rules        []rule
+	warningLabel string
+	// settings is what the config was built from.
+	settings Settings
+	// locked holds the fields repos can't override.
+	locked map[string]bool
 }
 
 // HelpProvider constructs the PluginHelp for this plugin that takes into account enabled repositories.
@@ -74,25 +105,48 @@ The plugin reacts to commit changes on PRs in addition to periodically scanning
 		nil
 }
 
-func (p *Plugin) SetConfig(m string, r *regexp.Regexp) {
+// SetConfig sets the regular expression titles need to match and the error
+// message posted when they don't. The title policy files of repos can't
+// override the lockedFields.
+func (p *Plugin) SetConfig(m string, r *regexp.Regexp, lockedFields ...string) {
+	p.Configure(Settings{
+		Regexp:       r,
+		ErrorMessage: m,
+		LockedFields: lockedFields,
+	})
+}
+
+func (p *Plugin) GetConfig() *pluginConfig {
 	p.mut.Lock()
 	defer p.mut.Unlock()
+	return p.c
+}
 
-	errorMessage := fmt.Sprintf(defaultNeedsRetitleMessage, r.String())
-	if len(m) > 0 {
-		errorMessage = m
-	}
+// SetScanOptions sets how scans use the GitHub API.
+func (p *Plugin) SetScanOptions(opts ScanOptions) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.opts = opts
+}
 
-	p.c = &pluginConfig{
-		errorMessage: errorMessage,
-		re:           r,
+// GetScanOptions returns how scans use the GitHub API, defaulting to
+// handling one PR at a time.
+func (p *Plugin) GetScanOptions() ScanOptions {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	opts := p.opts
+	if opts.Parallelism < 1 {
+		opts.Parallelism = 1
 	}
+	return opts
 }
 
-func (p *Plugin) GetConfig() *pluginConfig {
+// LastScan returns when HandleAll last completed successfully, it is zero
+// until the first successful scan.
+func (p *Plugin) LastScan() time.Time {
 	p.mut.Lock()
 	defer p.mut.Unlock()
-	return p.c
+	return p.lastScan
 }
 
 // HandlePullRequestEvent handles a GitHub pull request event and adds or removes a
@@ -105,7 +159,8 @@ func (p *Plugin) HandlePullRequestEvent(log *logrus.Entry, ghc githubClient, pre
 		return nil
 	}
 
-	return p.handle(log, ghc, &pre.PullRequest)
+	_, err := p.handle(log, ghc, &pre.PullRequest)
+	return err
 }
 
 // HandleIssueCommentEvent handles a GitHub issue comment event and adds or removes a
@@ -116,24 +171,19 @@ func (p *Plugin) HandleIssueCommentEvent(log *logrus.Entry, ghc githubClient, ic
 	}
 	pr, err := ghc.GetPullRequest(ice.Repo.Owner.Login, ice.Repo.Name, ice.Issue.Number)
 	if err != nil {
+		metrics.GitHubErrors.WithLabelValues("get_pull_request").Inc()
 		return err
 	}
 
-	return p.handle(log, ghc, pr)
+	_, err = p.handle(log, ghc, pr)
+	return err
 }
 
 // handle handles a GitHub PR to determine if the "needs-retitle"
 // label needs to be added or removed.
-func (p *Plugin) handle(log *logrus.Entry, ghc githubClient, pr *github.PullRequest) error {
+func (p *Plugin) handle(log *logrus.Entry, ghc githubClient, pr *github.PullRequest) ([]Action, error) {
 	if pr.Merged {
-		return nil
-	}
-
-	c := p.GetConfig()
-
-	if c == nil {
-		log.Warnf("No regular expression provided, please check your settings")
-		return nil
+		return nil, nil
 	}
 
 	org := pr.Base.Repo.Owner.Login
@@ -141,146 +191,450 @@ func (p *Plugin) handle(log *logrus.Entry, ghc githubClient, pr *github.PullRequ
 	number := pr.Number
 	title := pr.Title
 
+	if p.GetConfig() == nil {
+		log.Warnf("No regular expression provided, please check your settings")
+		return nil, nil
+	}
+	c, err := p.effectiveConfig(log, ghc, org, repo, number, pr.Base.Ref, pr.Base.SHA)
+	if err != nil {
+		return nil, err
+	}
+
 	issueLabels, err := ghc.GetIssueLabels(org, repo, number)
 	if err != nil {
-		return err
+		metrics.GitHubErrors.WithLabelValues("get_issue_labels").Inc()
+		return nil, err
+	}
+	var labels []string
+	for _, label := range issueLabels {
+		labels = append(labels, label.Name)
 	}
-	hasLabel := github.HasLabel(needsRetitleLabel, issueLabels)
 
-	return p.takeAction(log, ghc, org, repo, number, pr.User.Login, hasLabel, title, c)
+	return p.takeAction(log, ghc, prContext{
+		Org:        org,
+		Repo:       repo,
+		Number:     number,
+		Author:     pr.User.Login,
+		Title:      title,
+		BaseBranch: pr.Base.Ref,
+		CreatedAt:  pr.CreatedAt,
+	}, labels, c)
 }
 
 // HandleAll checks all orgs and repos that enabled this plugin for open PRs to
-// determine if the "needs-retitle" label needs to be added or removed.
+// determine if the "needs-retitle" label needs to be added or removed, then
+// follows up on the PRs that have carried the label for too long.
+// It returns an error if the search fails or if any PR couldn't be handled.
 func (p *Plugin) HandleAll(log *logrus.Entry, ghc githubClient, config *plugins.Configuration) error {
-	log.Info("Checking all PRs.")
+	result, err := p.Scan(log, ghc, config, Scope{})
+	if err != nil {
+		return err
+	}
+	if err := p.FollowUp(log, ghc, config, nil); err != nil {
+		log.WithError(err).Error("Error following up on labelled PRs.")
+	}
+	return result.Err()
+}
+
+// Scan checks the open PRs within the scope to determine if the
+// "needs-retitle" label needs to be added or removed. An empty scope checks
+// all orgs and repos that enabled this plugin. Only one scan runs at a time,
+// ErrScanInProgress is returned while another one is running. Errors
+// handling single PRs don't stop the scan, they are collected per repo in
+// the result.
+func (p *Plugin) Scan(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, scope Scope) (*ScanResult, error) {
+	if !p.scanMut.TryLock() {
+		return nil, ErrScanInProgress
+	}
+	defer p.scanMut.Unlock()
 
+	log = withScanID(log).WithField("scope", scope.String())
+	log.Info("Checking open PRs.")
+	start := time.Now()
+	if scope.IsAll() {
+		defer func() { metrics.HandleAllDuration.Observe(time.Since(start).Seconds()) }()
+	}
+
+	result := &ScanResult{DryRun: p.DryRun()}
+	defer func() { result.Plans = p.Plans(scope, start) }()
 	c := p.GetConfig()
 
 	if c == nil {
 		log.Warnf("No regular expression provided, please check your settings")
-		return nil
+		return result, nil
 	}
 
 	orgs, repos := config.EnabledReposForExternalPlugin(PluginName)
 	if len(orgs) == 0 && len(repos) == 0 {
 		log.Warnf("No repos have been configured for the %s plugin", PluginName)
-		return nil
+		return result, nil
 	}
-	var buf bytes.Buffer
-	fmt.Fprint(&buf, "archived:false is:pr is:open")
-	for _, org := range orgs {
-		fmt.Fprintf(&buf, " org:\"%s\"", org)
+	if err := scope.Validate(orgs, repos); err != nil {
+		return nil, err
 	}
-	for _, repo := range repos {
-		fmt.Fprintf(&buf, " repo:\"%s\"", repo)
+
+	if scope.Number > 0 {
+		if err := p.scanPullRequest(log, ghc, scope, result); err != nil {
+			log.WithError(err).Error("Error handling PR.")
+			result.addError(scope.Org, scope.Repo, scope.Number, err)
+		}
+		return result, nil
 	}
-	prs, err := search(context.Background(), log, ghc, buf.String())
+
+	opts := p.GetScanOptions()
+	var resultMut sync.Mutex
+	labelled := map[string]int{}
+
+	prCh := make(chan pullRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pr := range prCh {
+				org := string(pr.Repository.Owner.Login)
+				repo := string(pr.Repository.Name)
+				actions, isLabelled, err := p.handleSearchResult(log, ghc, pr)
+
+				resultMut.Lock()
+				if err != nil {
+					result.addError(org, repo, int(pr.Number), err)
+				}
+				result.Checked++
+				result.Actions = append(result.Actions, actions...)
+				n := labelled[org+"/"+repo]
+				if isLabelled {
+					n++
+				}
+				labelled[org+"/"+repo] = n
+				resultMut.Unlock()
+			}
+		}()
+	}
+	err := searchPartitioned(context.Background(), log, ghc, scope.baseQuery(), scope.partition(orgs, repos), opts.MinRateLimit, func(pr pullRequest) {
+		prCh <- pr
+	})
+	close(prCh)
+	wg.Wait()
 	if err != nil {
+		metrics.GitHubErrors.WithLabelValues("search").Inc()
+		return nil, err
+	}
+	log.Infof("Checked %d PRs.", result.Checked)
+
+	// Incremental scans don't see every PR, so they can't count them.
+	if !scope.IsIncremental() {
+		if scope.IsAll() {
+			metrics.LabelledPRs.Reset()
+		}
+		for repo, count := range labelled {
+			metrics.LabelledPRs.WithLabelValues(repo).Set(float64(count))
+		}
+	}
+
+	if scope.IsAll() && !scope.IsIncremental() {
+		p.forgetPlans(start)
+	}
+	if scope.IsAll() {
+		p.mut.Lock()
+		p.lastScan = time.Now()
+		p.mut.Unlock()
+	}
+	return result, nil
+}
+
+// handleSearchResult handles a PR found by the search. Along with the
+// actions taken it returns whether the PR carries the "needs-retitle" label
+// afterwards.
+func (p *Plugin) handleSearchResult(log *logrus.Entry, ghc githubClient, pr pullRequest) ([]Action, bool, error) {
+	org := string(pr.Repository.Owner.Login)
+	repo := string(pr.Repository.Name)
+	num := int(pr.Number)
+	title := string(pr.Title)
+	l := log.WithFields(logrus.Fields{
+		"org":  org,
+		"repo": repo,
+		"pr":   num,
+	})
+	hasLabel := pr.hasLabel(needsRetitleLabel)
+	var labels []string
+	for _, label := range pr.Labels.Nodes {
+		labels = append(labels, string(label.Name))
+	}
+	c, err := p.effectiveConfig(l, ghc, org, repo, num, string(pr.BaseRefName), string(pr.BaseRefOid))
+	if err != nil {
+		l.WithError(err).Error("Error handling PR.")
+		return nil, hasLabel, err
+	}
+	prc := prContext{
+		Org:        org,
+		Repo:       repo,
+		Number:     num,
+		Author:     string(pr.Author.Login),
+		Title:      title,
+		BaseBranch: string(pr.BaseRefName),
+		CreatedAt:  pr.CreatedAt.Time,
+	}
+	actions, err := p.takeAction(l, ghc, prc, labels, c)
+	if err != nil {
+		l.WithError(err).Error("Error handling PR.")
+		// Assume the label was left as it was.
+		return actions, hasLabel, err
+	}
+	if p.DryRun() || c.shadow(org, repo) {
+		// The label was left as it was.
+		return actions, hasLabel, nil
+	}
+	return actions, !c.evaluate(prc).Passed(), nil
+}
+
+// scanPullRequest checks a single PR, closed PRs are ignored.
+func (p *Plugin) scanPullRequest(log *logrus.Entry, ghc githubClient, scope Scope, result *ScanResult) error {
+	pr, err := ghc.GetPullRequest(scope.Org, scope.Repo, scope.Number)
+	if err != nil {
+		metrics.GitHubErrors.WithLabelValues("get_pull_request").Inc()
 		return err
 	}
-	log.Infof("Considering %d PRs.", len(prs))
-
-	for _, pr := range prs {
-		org := string(pr.Repository.Owner.Login)
-		repo := string(pr.Repository.Name)
-		num := int(pr.Number)
-		title := string(pr.Title)
-		l := log.WithFields(logrus.Fields{
-			"org":  org,
-			"repo": repo,
-			"pr":   num,
-		})
-		hasLabel := false
-		for _, label := range pr.Labels.Nodes {
-			if label.Name == needsRetitleLabel {
-				hasLabel = true
-				break
+	if pr.State != "open" {
+		log.Infof("Ignoring %s PR.", pr.State)
+		return nil
+	}
+	actions, err := p.handle(log, ghc, pr)
+	result.Checked++
+	result.Actions = append(result.Actions, actions...)
+	return err
+}
+
+// takeAction adds or removes the "needs-retitle" label, and the warning
+// label when one is configured, based on the current labels of the PR and
+// the rules broken by the title. It also handles adding and removing GitHub
+// comments notifying the PR author of the rules broken by the title, which
+// are replaced whenever the rules broken change. Nothing is changed when
+// the labels and the comment are up to date. Labels are added before the
+// comment is posted, so PRs never get a comment about a label they don't
+// carry, and comments are pruned before labels are removed. No comment is
+// posted twice, so if any step fails the next evaluation of the PR finishes
+// the transition. It returns the actions that were taken, even if a later
+// one failed.
+func (p *Plugin) takeAction(log *logrus.Entry, ghc githubClient, pr prContext, labels []string, c *pluginConfig) ([]Action, error) {
+	org, repo, num := pr.Org, pr.Repo, pr.Number
+	evaluation := c.evaluate(pr)
+	shadow := c.shadow(org, repo)
+	var actions []Action
+	record := func(t ActionType, label string) {
+		actions = append(actions, Action{Org: org, Repo: repo, Number: num, Type: t, Label: label})
+		p.writeAudit(log, c, pr, t, label, evaluation)
+		if shadow {
+			metrics.ShadowActions.WithLabelValues(org+"/"+repo, string(t)).Inc()
+		}
+	}
+
+	metrics.Evaluations.WithLabelValues(evaluation.Verdict, org+"/"+repo).Inc()
+
+	want := map[string]bool{needsRetitleLabel: !evaluation.Passed()}
+	if len(c.warningLabel) > 0 {
+		want[c.warningLabel] = evaluation.has(SeverityWarning)
+	}
+	var toAdd, toRemove []string
+	for _, label := range []string{needsRetitleLabel, c.warningLabel} {
+		if len(label) == 0 {
+			continue
+		}
+		has := github.HasLabel(label, toGitHubLabels(labels))
+		if want[label] && !has {
+			toAdd = append(toAdd, label)
+		} else if !want[label] && has {
+			toRemove = append(toRemove, label)
+		}
+	}
+	dryRun := p.DryRun() || shadow
+
+	// The comments are only listed if they aren't cached, so once they are,
+	// PRs whose labels and comment are up to date are left alone without
+	// calling GitHub.
+	botLogin, comments, err := p.botComments(log, ghc, org, repo, num)
+	if err != nil {
+		return actions, err
+	}
+	isNotice := shouldPrune(botLogin, c.errorMessage)
+	body := c.notice(pr, evaluation)
+	commented := false
+	stale := map[int]bool{}
+	for _, ic := range comments {
+		if !isNotice(ic) {
+			continue
+		}
+		if len(body) > 0 && ic.Body == body && !commented {
+			commented = true
+		} else {
+			stale[ic.ID] = true
+		}
+	}
+	upToDate := len(toAdd) == 0 && len(toRemove) == 0 && (len(body) == 0 || commented) && len(stale) == 0
+
+	if dryRun {
+		plan := Plan{
+			Time:    time.Now(),
+			Org:     org,
+			Repo:    repo,
+			Number:  num,
+			Title:   pr.Title,
+			Verdict: evaluation.Verdict,
+			Shadow:  shadow,
+			Comment: CommentState{Desired: body},
+		}
+		for _, label := range []string{needsRetitleLabel, c.warningLabel} {
+			if len(label) > 0 {
+				plan.Labels = append(plan.Labels, LabelState{Label: label, Desired: want[label], Actual: github.HasLabel(label, toGitHubLabels(labels))})
 			}
 		}
-		err := p.takeAction(
-			l,
-			ghc,
-			org,
-			repo,
-			num,
-			string(pr.Author.Login),
-			hasLabel,
-			title,
-			c,
-		)
-		if err != nil {
-			l.WithError(err).Error("Error handling PR.")
+		for _, ic := range comments {
+			if isNotice(ic) {
+				plan.Comment.Actual = append(plan.Comment.Actual, ic.Body)
+			}
 		}
+		defer func() {
+			plan.Actions = actions
+			p.recordPlan(log, plan)
+		}()
+	}
+	if upToDate {
+		return nil, nil
+	}
+
+	for _, label := range toAdd {
+		if !dryRun {
+			if err := retry(log, "add_label", func() error {
+				return ghc.AddLabel(org, repo, num, label)
+			}); err != nil {
+				return actions, fmt.Errorf("adding %q label: %w", label, err)
+			}
+			metrics.Labels.WithLabelValues("added").Inc()
+		}
+		record(ActionAddLabel, label)
 	}
-	return nil
-}
 
-// takeAction adds or removes the "needs-rebase" label based on the current
-// state of the PR (hasLabel and mergeable). It also handles adding and
-// removing GitHub comments notifying the PR author that a rebase is needed.
-func (p *Plugin) takeAction(log *logrus.Entry, ghc githubClient, org, repo string, num int, author string, hasLabel bool, title string, c *pluginConfig) error {
-	needsRetitleMessage := c.errorMessage
-	titleOk := c.re.MatchString(title)
-	if !titleOk && !hasLabel {
-		if err := ghc.AddLabel(org, repo, num, needsRetitleLabel); err != nil {
-			log.WithError(err).Errorf("Failed to add %q label.", needsRetitleLabel)
+	if len(body) > 0 && !commented {
+		if !dryRun {
+			p.comments.forget(org, repo, num)
+			if err := retry(log, "create_comment", func() error {
+				return ghc.CreateComment(org, repo, num, body)
+			}); err != nil {
+				return actions, fmt.Errorf("creating comment: %w", err)
+			}
+			metrics.Comments.WithLabelValues("created").Inc()
 		}
-		msg := plugins.FormatSimpleResponse(author, needsRetitleMessage)
-		return ghc.CreateComment(org, repo, num, msg)
-	} else if titleOk && hasLabel {
-		// remove label and prune comment
-		if err := ghc.RemoveLabel(org, repo, num, needsRetitleLabel); err != nil {
-			log.WithError(err).Errorf("Failed to remove %q label.", needsRetitleLabel)
+		record(ActionCreateComment, "")
+	}
+
+	if len(stale) > 0 {
+		if !dryRun {
+			p.comments.forget(org, repo, num)
+			deleted := 0
+			if err := retry(log, "delete_stale_comments", func() error {
+				return ghc.DeleteStaleComments(org, repo, num, comments, func(ic github.IssueComment) bool {
+					if stale[ic.ID] {
+						deleted++
+						return true
+					}
+					return false
+				})
+			}); err != nil {
+				return actions, fmt.Errorf("pruning comments: %w", err)
+			}
+			metrics.Comments.WithLabelValues("deleted").Add(float64(deleted))
 		}
-		botUser, err := ghc.BotUser()
-		botName := botUser.Name
-		if err != nil {
-			return err
+		record(ActionPruneComments, "")
+	}
+
+	for _, label := range toRemove {
+		if !dryRun {
+			if err := retry(log, "remove_label", func() error {
+				return removeLabel(ghc, org, repo, num, label)
+			}); err != nil {
+				return actions, fmt.Errorf("removing %q label: %w", label, err)
+			}
+			metrics.Labels.WithLabelValues("removed").Inc()
 		}
-		return ghc.DeleteStaleComments(org, repo, num, nil, shouldPrune(botName, needsRetitleMessage))
+		record(ActionRemoveLabel, label)
 	}
-	return nil
+	return actions, nil
 }
 
+func toGitHubLabels(names []string) []github.Label {
+	labels := make([]github.Label, 0, len(names))
+	for _, name := range names {
+		labels = append(labels, github.Label{Name: name})
+	}
+	return labels
+}
+
+// shouldPrune returns true for the comments the bot posted about titles,
+// including the ones posted before they were marked with noticeMarker.
 func shouldPrune(botName string, msg string) func(github.IssueComment) bool {
 	return func(ic github.IssueComment) bool {
 		return github.NormLogin(botName) == github.NormLogin(ic.User.Login) &&
-			strings.Contains(ic.Body, msg)
+			(strings.Contains(ic.Body, noticeMarker) || strings.Contains(ic.Body, msg))
 	}
 }
 
-func search(ctx context.Context, log *logrus.Entry, ghc githubClient, q string) ([]pullRequest, error) {
-	var ret []pullRequest
+// search pages through the PRs matching the query and passes each page to fn
+// as it comes in. It returns the number of PRs matching the query. When limit
+// is set and the query matches more PRs than that, errTooManyResults is
+// returned before any PR is passed to fn. When fewer than minRateLimit points
+// are left it waits for the rate limit to reset before fetching the next
+// page.
+func search(ctx context.Context, log *logrus.Entry, ghc githubClient, q string, minRateLimit, limit int, fn func(pullRequest)) (int, error) {
 	vars := map[string]interface{}{
 		"query":        githubql.String(q),
 		"searchCursor": (*githubql.String)(nil),
 	}
 	var totalCost int
 	var remaining int
-	for {
+	var total int
+	for page := 0; ; page++ {
 		sq := searchQuery{}
 		if err := ghc.QueryWithGitHubAppsSupport(ctx, &sq, vars, ""); err != nil {
-			return nil, err
+			return 0, err
 		}
 		totalCost += int(sq.RateLimit.Cost)
 		remaining = int(sq.RateLimit.Remaining)
+		if page == 0 {
+			total = int(sq.Search.IssueCount)
+			if limit > 0 && total > limit {
+				log.Infof("Search for query \"%s\" cost %d point(s). %d remaining.", q, totalCost, remaining)
+				return total, errTooManyResults
+			}
+			if total > searchLimit {
+				log.Warnf("Query \"%s\" matches %d PRs, only the first %d will be checked.", q, total, searchLimit)
+			}
+		}
 		for _, n := range sq.Search.Nodes {
-			ret = append(ret, n.PullRequest)
+			fn(n.PullRequest)
 		}
 		if !sq.Search.PageInfo.HasNextPage {
 			break
 		}
 		vars["searchCursor"] = githubql.NewString(sq.Search.PageInfo.EndCursor)
+		if remaining < minRateLimit {
+			if wait := time.Until(sq.RateLimit.ResetAt.Time); wait > 0 {
+				log.Warnf("Only %d rate limit point(s) remaining, pausing for %v until the rate limit resets.", remaining, wait)
+				sleep(wait)
+			}
+		}
 	}
 	log.Infof("Search for query \"%s\" cost %d point(s). %d remaining.", q, totalCost, remaining)
-	return ret, nil
+	return total, nil
 }
 
 type pullRequest struct {
-	Number githubql.Int
-	Title  githubql.String
-	Author struct {
+	Number      githubql.Int
+	Title       githubql.String
+	URL         githubql.String
+	CreatedAt   githubql.DateTime
+	BaseRefName githubql.String
+	BaseRefOid  githubql.String
+	Author      struct {
 		Login githubql.String
 	}
 	Repository struct {
@@ -296,13 +650,24 @@ type pullRequest struct {
 	} `graphql:"labels(first:100)"`
 }
 
+func (pr *pullRequest) hasLabel(name string) bool {
+	for _, label := range pr.Labels.Nodes {
+		if string(label.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
 type searchQuery struct {
 	RateLimit struct {
 		Cost      githubql.Int
 		Remaining githubql.Int
+		ResetAt   githubql.DateTime
 	}
 	Search struct {
-		PageInfo struct {
+		IssueCount githubql.Int
+		PageInfo   struct {
 			HasNextPage githubql.Boolean
 			EndCursor   githubql.String
 		}
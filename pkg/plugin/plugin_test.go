@@ -23,11 +23,15 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/labels"
@@ -39,6 +43,7 @@ func testKey(org, repo string, num int) string {
 }
 
 type fghc struct {
+	sync.Mutex
 	allPRs []struct {
 		PullRequest pullRequest `graphql:"... on PullRequest"`
 	}
@@ -46,6 +51,25 @@ type fghc struct {
 
 	initialLabels []github.Label
 
+	createCommentErr error
+	addLabelErr      error
+	removeLabelErr   error
+	closeErr         error
+
+	comments        []github.IssueComment
+	commentRequests int
+	lastComment     string
+
+	// events and closed are keyed using 'testKey'
+	events map[string][]github.ListedIssueEvent
+	closed map[string]bool
+
+	// files is keyed by org/repo@sha
+	files        map[string]string
+	fileRequests int
+
+	queries []string
+
 	// The following are maps are keyed using 'testKey'
 	commentCreated, commentDeleted       map[string]bool
 	IssueLabelsAdded, IssueLabelsRemoved map[string][]string
@@ -76,7 +100,13 @@ func (f *fghc) GetIssueLabels(org, repo string, number int) ([]github.Label, err
 }
 
 func (f *fghc) CreateComment(org, repo string, number int, comment string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.createCommentErr != nil {
+		return f.createCommentErr
+	}
 	f.commentCreated[testKey(org, repo, number)] = true
+	f.lastComment = comment
 	return nil
 }
 
@@ -85,27 +115,42 @@ func (c *fghc) BotUser() (*github.UserData, error) {
 }
 
 func (f *fghc) AddLabel(org, repo string, number int, label string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.addLabelErr != nil {
+		return f.addLabelErr
+	}
 	key := testKey(org, repo, number)
 	f.IssueLabelsAdded[key] = append(f.IssueLabelsAdded[key], label)
 	return nil
 }
 
 func (f *fghc) RemoveLabel(org, repo string, number int, label string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.removeLabelErr != nil {
+		return f.removeLabelErr
+	}
 	key := testKey(org, repo, number)
 	f.IssueLabelsRemoved[key] = append(f.IssueLabelsRemoved[key], label)
 	return nil
 }
 
 func (f *fghc) DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	f.Lock()
+	defer f.Unlock()
 	f.commentDeleted[testKey(org, repo, number)] = true
 	return nil
 }
 
-func (f *fghc) QueryWithGitHubAppsSupport(_ context.Context, q interface{}, _ map[string]interface{}, _ string) error {
+func (f *fghc) QueryWithGitHubAppsSupport(_ context.Context, q interface{}, vars map[string]interface{}, _ string) error {
 	query, ok := q.(*searchQuery)
 	if !ok {
 		return errors.New("invalid query format")
 	}
+	f.Lock()
+	defer f.Unlock()
+	f.queries = append(f.queries, string(vars["query"].(githubql.String)))
 	query.Search.Nodes = f.allPRs
 	return nil
 }
@@ -117,6 +162,44 @@ func (f *fghc) GetPullRequest(org, repo string, number int) (*github.PullRequest
 	return nil, fmt.Errorf("didn't find pull request %s/%s#%d", org, repo, number)
 }
 
+func (f *fghc) GetFile(org, repo, filepath, commit string) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.fileRequests++
+	if content, ok := f.files[org+"/"+repo+"@"+commit]; ok && filepath == RepoConfigPath {
+		return []byte(content), nil
+	}
+	return nil, &github.FileNotFound{}
+}
+
+func (f *fghc) ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error) {
+	return f.events[testKey(org, repo, num)], nil
+}
+
+func (f *fghc) ClosePR(org, repo string, number int) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.closeErr != nil {
+		return f.closeErr
+	}
+	if f.closed == nil {
+		f.closed = map[string]bool{}
+	}
+	f.closed[testKey(org, repo, number)] = true
+	return nil
+}
+
+func (f *fghc) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.commentRequests++
+	return f.comments, nil
+}
+
+func (f *fghc) GetRepos(org string, isUser bool) ([]github.Repo, error) {
+	return nil, nil
+}
+
 func (f *fghc) compareExpected(t *testing.T, org, repo string, num int, expectedAdded []string, expectedRemoved []string, expectComment bool, expectDeletion bool) {
 	key := testKey(org, repo, num)
 	sort.Strings(expectedAdded)
@@ -184,10 +267,12 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 			labels: []string{labels.LGTM},
 		},
 		{
-			name:   "wrong title no-op",
+			name:   "wrong title without comment comments",
 			re:     "^(fix:|feat:|major:).*$",
 			pr:     pr("this title is wrong..."),
 			labels: []string{labels.LGTM, needsRetitleLabel},
+
+			expectComment: true,
 		},
 		{
 			name:   "wrong title adds label",
@@ -210,7 +295,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 			labels: []string{labels.LGTM, needsRetitleLabel},
 
 			expectedRemoved: []string{needsRetitleLabel},
-			expectDeletion:  true,
 		},
 		{
 			name:   "merged pr is ignored",
@@ -225,10 +309,10 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 			testSubject := &Plugin{}
 			if len(tc.re) > 0 {
 				r, _ := regexp.Compile(tc.re)
-				testSubject.c = &pluginConfig{
-					errorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, "some regexp"),
-					re:           r,
-				}
+				testSubject.c = newPluginConfig(Settings{
+					Regexp:       r,
+					ErrorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, "some regexp"),
+				})
 			}
 			fake := newFakeClient(nil, tc.labels, tc.pr)
 			ice := &github.IssueCommentEvent{}
@@ -253,9 +337,11 @@ func TestHandlePullRequestEvent(t *testing.T) {
 		name string
 		re   string
 
-		title  string
-		merged bool
-		labels []string
+		title         string
+		merged        bool
+		labels        []string
+		createdAt     time.Time
+		effectiveFrom string
 
 		expectedAdded   []string
 		expectedRemoved []string
@@ -269,10 +355,12 @@ func TestHandlePullRequestEvent(t *testing.T) {
 			labels: []string{labels.LGTM},
 		},
 		{
-			name:   "wrong title no-op",
+			name:   "wrong title without comment comments",
 			re:     "^(fix:|feat:|major:).*$",
 			title:  "fixing: wrong title",
 			labels: []string{labels.LGTM, needsRetitleLabel},
+
+			expectComment: true,
 		},
 		{
 			name:   "wrong title adds label",
@@ -283,6 +371,25 @@ func TestHandlePullRequestEvent(t *testing.T) {
 			expectedAdded: []string{needsRetitleLabel},
 			expectComment: true,
 		},
+		{
+			name:          "wrong title in PR created before the rule took effect no-op",
+			re:            "^(fix:|feat:|major:).*$",
+			title:         "fixing: wrong title",
+			labels:        []string{labels.LGTM},
+			createdAt:     time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+			effectiveFrom: "2024-06-01",
+		},
+		{
+			name:          "wrong title in PR created after the rule took effect adds label",
+			re:            "^(fix:|feat:|major:).*$",
+			title:         "fixing: wrong title",
+			labels:        []string{labels.LGTM},
+			createdAt:     time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC),
+			effectiveFrom: "2024-06-01",
+
+			expectedAdded: []string{needsRetitleLabel},
+			expectComment: true,
+		},
 		{
 			name:   "wrong title, no config ignores it",
 			title:  "fixing: wrong title",
@@ -295,7 +402,6 @@ func TestHandlePullRequestEvent(t *testing.T) {
 			labels: []string{labels.LGTM, needsRetitleLabel},
 
 			expectedRemoved: []string{needsRetitleLabel},
-			expectDeletion:  true,
 		},
 		{
 			name:   "merged pr is ignored",
@@ -308,10 +414,11 @@ func TestHandlePullRequestEvent(t *testing.T) {
 		testSubject := &Plugin{}
 		if len(tc.re) > 0 {
 			r, _ := regexp.Compile(tc.re)
-			testSubject.c = &pluginConfig{
-				errorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, "some regexp"),
-				re:           r,
-			}
+			testSubject.c = newPluginConfig(Settings{
+				Regexp:        r,
+				ErrorMessage:  fmt.Sprintf(defaultNeedsRetitleMessage, "some regexp"),
+				EffectiveFrom: tc.effectiveFrom,
+			})
 		}
 		fake := newFakeClient(nil, tc.labels, nil)
 		pre := &github.PullRequestEvent{
@@ -323,9 +430,10 @@ func TestHandlePullRequestEvent(t *testing.T) {
 						Owner: github.User{Login: "org"},
 					},
 				},
-				Title:  tc.title,
-				Merged: tc.merged,
-				Number: 5,
+				Title:     tc.title,
+				Merged:    tc.merged,
+				Number:    5,
+				CreatedAt: tc.createdAt,
 			},
 		}
 		t.Logf("Running test scenario: %q", tc.name)
@@ -343,10 +451,10 @@ func TestHandleAll(t *testing.T) {
 	}
 
 	testSubject := &Plugin{
-		c: &pluginConfig{
-			errorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, r.String()),
-			re:           r,
-		},
+		c: newPluginConfig(Settings{
+			Regexp:       r,
+			ErrorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, r.String()),
+		}),
 	}
 
 	testPRs := []struct {
@@ -363,6 +471,8 @@ func TestHandleAll(t *testing.T) {
 		{
 			title:  "blah blah blah",
 			labels: []string{labels.LGTM, needsRetitleLabel},
+
+			expectComment: true,
 		},
 		{
 			title:  "bleh bleh bleh",
@@ -376,7 +486,6 @@ func TestHandleAll(t *testing.T) {
 			labels: []string{labels.LGTM, needsRetitleLabel},
 
 			expectedRemoved: []string{needsRetitleLabel},
-			expectDeletion:  true,
 		},
 	}
 
@@ -410,10 +519,183 @@ func TestHandleAll(t *testing.T) {
 		ExternalPlugins: map[string][]plugins.ExternalPlugin{"/": {{Name: PluginName}}},
 	}
 
-	if err := testSubject.HandleAll(logrus.WithField("plugin", PluginName), fake, config); err != nil {
+	result, err := testSubject.Scan(logrus.WithField("plugin", PluginName), fake, config, Scope{})
+	if err != nil {
 		t.Fatalf("Unexpected error handling all prs: %v.", err)
 	}
+	if result.Checked != len(testPRs) {
+		t.Errorf("Expected %d PRs to be checked, but got %d.", len(testPRs), result.Checked)
+	}
+	if len(result.Actions) != 4 {
+		t.Errorf("Expected 4 actions to be taken, but got %v.", result.Actions)
+	}
 	for i, pr := range testPRs {
 		fake.compareExpected(t, "", "", i, pr.expectedAdded, pr.expectedRemoved, pr.expectComment, pr.expectDeletion)
 	}
+	if labelled := testutil.ToFloat64(metrics.LabelledPRs.WithLabelValues("/")); labelled != 2 {
+		t.Errorf("Expected 2 labelled PRs to be reported, but got %v.", labelled)
+	}
+}
+
+func testPR(title string) prContext {
+	return prContext{Org: "org", Repo: "repo", Number: 1, Author: "author", Title: title, BaseBranch: "main"}
+}
+
+func TestTakeActionTransitions(t *testing.T) {
+	oldSleep := sleep
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = oldSleep }()
+
+	r := regexp.MustCompile("^(fix:|feat:|major:).*$")
+	c := newPluginConfig(Settings{
+		Regexp:       r,
+		ErrorMessage: fmt.Sprintf(defaultNeedsRetitleMessage, r.String()),
+	})
+	testSubject := &Plugin{c: c}
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+
+	// Adding the label keeps failing, no comment is posted and the error
+	// is returned after retrying with backoff.
+	fake := newFakeClient(nil, nil, nil)
+	fake.addLabelErr = errors.New("injected error")
+	actions, err := testSubject.takeAction(log, fake, testPR("wrong title"), nil, c)
+	assert.EqualError(t, err, `adding "needs-retitle" label: injected error`)
+	assert.Empty(t, actions)
+	assert.False(t, fake.commentCreated[key])
+	assert.Equal(t, []time.Duration{retryBackoff, 2 * retryBackoff}, slept)
+
+	// The next evaluation adds the label, then posting the comment fails.
+	fake = newFakeClient(nil, nil, nil)
+	fake.createCommentErr = errors.New("status code 403 not one of [201], body: Resource not accessible by integration")
+	actions, err = testSubject.takeAction(log, fake, testPR("wrong title"), nil, c)
+	assert.Error(t, err)
+	assert.Equal(t, []Action{{Org: "org", Repo: "repo", Number: 1, Type: ActionAddLabel, Label: needsRetitleLabel}}, actions)
+	assert.Equal(t, []string{needsRetitleLabel}, fake.IssueLabelsAdded[key])
+
+	// The one after posts the comment without adding the label again.
+	fake = newFakeClient(nil, nil, nil)
+	actions, err = testSubject.takeAction(log, fake, testPR("wrong title"), []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{{Org: "org", Repo: "repo", Number: 1, Type: ActionCreateComment}}, actions)
+	assert.True(t, fake.commentCreated[key])
+	assert.Empty(t, fake.IssueLabelsAdded[key])
+
+	// Fixed titles get their comments pruned before the label is removed.
+	fake.comments = []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: fake.lastComment}}
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: right title"), []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionPruneComments},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionRemoveLabel, Label: needsRetitleLabel},
+	}, actions)
+
+	// A label removed in the meantime counts as removed.
+	slept = nil
+	fake = newFakeClient(nil, nil, nil)
+	fake.removeLabelErr = &github.LabelNotFound{Owner: "org", Repo: "repo", Number: 1, Label: needsRetitleLabel}
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: right title"), []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	assert.Contains(t, actions, Action{Org: "org", Repo: "repo", Number: 1, Type: ActionRemoveLabel, Label: needsRetitleLabel})
+	assert.Empty(t, slept)
+
+	// Permanent errors aren't retried.
+	fake = newFakeClient(nil, nil, nil)
+	fake.addLabelErr = errors.New("status code 403 not one of [200], body: Resource not accessible by integration")
+	_, err = testSubject.takeAction(log, fake, testPR("wrong title"), nil, c)
+	assert.Error(t, err)
+	assert.Empty(t, slept)
+}
+
+func TestTakeActionWarnings(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp:       regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Rules:        []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}},
+		WarningLabel: "title/warning",
+	})
+	testSubject := &Plugin{c: c}
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+
+	// Fixing the prefix of a long title swaps the labels and the comment.
+	fake := newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{{
+		ID:   1,
+		User: github.User{Login: "me"},
+		Body: c.notice(testPR("this title is far too long"), c.evaluate(testPR("this title is far too long"))),
+	}}
+	actions, err := testSubject.takeAction(log, fake, testPR("fix: this title is far too long"), []string{needsRetitleLabel}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionAddLabel, Label: "title/warning"},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionCreateComment},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionPruneComments},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionRemoveLabel, Label: needsRetitleLabel},
+	}, actions)
+	assert.Equal(t, []string{"title/warning"}, fake.IssueLabelsAdded[key])
+	assert.Equal(t, []string{needsRetitleLabel}, fake.IssueLabelsRemoved[key])
+	assert.Contains(t, fake.lastComment, "| `length` | warning | The title doesn't match the pattern of the rule. |")
+	assert.Contains(t, fake.lastComment, "```\n^.{0,20}$\n```")
+
+	// Nothing changes while the warning stands.
+	warning := fake.lastComment
+	fake = newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{{ID: 2, User: github.User{Login: "me"}, Body: warning}}
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: this title is far too long"), []string{"title/warning"}, c)
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: this title is far too long"), []string{"title/warning"}, c)
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	assert.Equal(t, 1, fake.commentRequests)
+
+	// The comment is replaced when the rules broken change, even if the
+	// labels don't.
+	r := regexp.MustCompile("^(fix:|feat:|major:).*$")
+	c = newPluginConfig(Settings{
+		Regexp:       r,
+		Rules:        []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}, {Name: "case", Regexp: "^[^A-Z]*$", Severity: SeverityWarning}},
+		WarningLabel: "title/warning",
+	})
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: This title is far too long"), []string{"title/warning"}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionCreateComment},
+		{Org: "org", Repo: "repo", Number: 1, Type: ActionPruneComments},
+	}, actions)
+	assert.Contains(t, fake.lastComment, "| `case` | warning |")
+}
+
+func TestTakeActionWarningsWithoutLabel(t *testing.T) {
+	c := newPluginConfig(Settings{
+		Regexp: regexp.MustCompile("^(fix:|feat:|major:).*$"),
+		Rules:  []Rule{{Name: "length", Regexp: "^.{0,20}$", Severity: SeverityWarning}},
+	})
+	testSubject := &Plugin{c: c}
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+	long := testPR("fix: this title is far too long")
+
+	// A title only breaking warning rules gets a comment and no label.
+	fake := newFakeClient(nil, nil, nil)
+	actions, err := testSubject.takeAction(log, fake, long, nil, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{{Org: "org", Repo: "repo", Number: 1, Type: ActionCreateComment}}, actions)
+	assert.Empty(t, fake.IssueLabelsAdded[key])
+
+	// Fixing the title prunes the warning comment.
+	fake = newFakeClient(nil, nil, nil)
+	fake.comments = []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: c.notice(long, c.evaluate(long))}}
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: short"), nil, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{{Org: "org", Repo: "repo", Number: 1, Type: ActionPruneComments}}, actions)
+	assert.True(t, fake.commentDeleted[key])
+
+	// Once it's pruned nothing else happens.
+	fake = newFakeClient(nil, nil, nil)
+	actions, err = testSubject.takeAction(log, fake, testPR("fix: short"), nil, c)
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+	assert.False(t, fake.commentDeleted[key])
 }
@@ -0,0 +1,422 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// RepoConfigPath is the path of the optional title policy file read
+	// from the base branch of PRs.
+	RepoConfigPath = ".github/needs-retitle.yaml"
+
+	// LockedRegexp, LockedErrorMessage, LockedSeverity, LockedEffectiveFrom,
+	// LockedRules, LockedWarningLabel, LockedExamples, LockedDocsURL and
+	// LockedEscalation are the fields of the central config that can be
+	// locked so repos can't override them.
+	LockedRegexp        = "regexp"
+	LockedErrorMessage  = "error_message"
+	LockedSeverity      = "severity"
+	LockedEffectiveFrom = "effective_from"
+	LockedRules         = "rules"
+	LockedWarningLabel  = "warning_label"
+	LockedExamples      = "examples"
+	LockedDocsURL       = "docs_url"
+	LockedEscalation    = "escalation"
+
+	repoConfigErrorMarker = "<!-- needs-retitle: invalid repo config -->"
+
+	// repoConfigCacheSize is the number of title policy files cached.
+	repoConfigCacheSize = 1000
+)
+
+// LockableFields are the fields of the central config that can be locked.
+var LockableFields = []string{LockedRegexp, LockedErrorMessage, LockedSeverity, LockedEffectiveFrom, LockedRules, LockedWarningLabel, LockedExamples, LockedDocsURL, LockedEscalation}
+
+// repoConfig is the title policy file of a repo. It only has the fields of
+// the central config that can be locked, listed in LockableFields, the
+// other ones can't be set per repo.
+type repoConfig struct {
+	Regexp        string   `json:"regexp,omitempty"`
+	ErrorMessage  string   `json:"error_message,omitempty"`
+	Severity      string   `json:"severity,omitempty"`
+	EffectiveFrom string   `json:"effective_from,omitempty"`
+	Rules         []Rule   `json:"rules,omitempty"`
+	WarningLabel  string   `json:"warning_label,omitempty"`
+	Examples      []string `json:"examples,omitempty"`
+	DocsURL       string   `json:"docs_url,omitempty"`
+	// Escalation is set when the field is in the file, even if it's empty,
+	// so repos can turn escalation off.
+	Escalation []EscalationStep `json:"escalation,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// RepoConfigError is returned when the title policy file of a repo can't be
+// used, PRs are then checked with the central rules.
+type RepoConfigError struct {
+	Org, Repo, SHA string
+	Err            error
+}
+
+func (e *RepoConfigError) Error() string {
+	return fmt.Sprintf("invalid %s in %s/%s@%s: %v", RepoConfigPath, e.Org, e.Repo, e.SHA, e.Err)
+}
+
+func (e *RepoConfigError) Unwrap() error {
+	return e.Err
+}
+
+// repoConfigCache keeps the title policy files loaded from each repo by
+// commit, evicting the least recently used ones beyond
+// repoConfigCacheSize, along with the commit last seen for each branch.
+type repoConfigCache struct {
+	mut sync.Mutex
+	// files holds the *repoConfigEntry of each org/repo@sha.
+	files *lru
+	// branches maps org/repo:branch to the last commit seen.
+	branches map[string]string
+}
+
+// repoConfigEntry is the file loaded at a commit, a nil file without an
+// error means the repo has no file.
+type repoConfigEntry struct {
+	c   *repoConfig
+	err error
+}
+
+func (rc *repoConfigCache) get(org, repo, sha string) (*repoConfig, error, bool) {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	if rc.files == nil {
+		return nil, nil, false
+	}
+	v, ok := rc.files.get(org + "/" + repo + "@" + sha)
+	if !ok {
+		return nil, nil, false
+	}
+	entry := v.(*repoConfigEntry)
+	return entry.c, entry.err, true
+}
+
+func (rc *repoConfigCache) put(org, repo, sha string, c *repoConfig, err error) {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	if rc.files == nil {
+		rc.files = newLRU(repoConfigCacheSize)
+	}
+	rc.files.put(org+"/"+repo+"@"+sha, &repoConfigEntry{c: c, err: err})
+}
+
+// seen records sha as the last commit seen for the branch.
+func (rc *repoConfigCache) seen(org, repo, branch, sha string) {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	if rc.branches == nil {
+		rc.branches = map[string]string{}
+	}
+	rc.branches[org+"/"+repo+":"+branch] = sha
+}
+
+// latest returns the file at the last commit seen for the branch, and false
+// if it isn't loaded.
+func (rc *repoConfigCache) latest(org, repo, branch string) (*repoConfig, bool) {
+	rc.mut.Lock()
+	sha, ok := rc.branches[org+"/"+repo+":"+branch]
+	rc.mut.Unlock()
+	if !ok {
+		return nil, false
+	}
+	c, _, ok := rc.get(org, repo, sha)
+	return c, ok
+}
+
+// loadRepoConfig loads the title policy file of org/repo at the commit sha of
+// branch, unless it's already cached. It returns a *RepoConfigError if the
+// file is malformed.
+func (p *Plugin) loadRepoConfig(log *logrus.Entry, ghc githubClient, org, repo, branch, sha string) error {
+	if len(sha) == 0 {
+		return nil
+	}
+	if _, err, ok := p.repoConfigs.get(org, repo, sha); ok {
+		p.repoConfigs.seen(org, repo, branch, sha)
+		return err
+	}
+
+	b, err := ghc.GetFile(org, repo, RepoConfigPath, sha)
+	var notFound *github.FileNotFound
+	if errors.As(err, &notFound) {
+		p.repoConfigs.put(org, repo, sha, nil, nil)
+		p.repoConfigs.seen(org, repo, branch, sha)
+		return nil
+	} else if err != nil {
+		metrics.GitHubErrors.WithLabelValues("get_file").Inc()
+		return err
+	}
+
+	c, err := parseRepoConfig(b)
+	if err != nil {
+		err = &RepoConfigError{Org: org, Repo: repo, SHA: sha, Err: err}
+	} else if central := p.GetConfig(); central != nil {
+		for _, field := range central.overridesLocked(c) {
+			log.Warnf("Ignoring %s from %s, the field is locked.", field, RepoConfigPath)
+		}
+	}
+	p.repoConfigs.put(org, repo, sha, c, err)
+	p.repoConfigs.seen(org, repo, branch, sha)
+	return err
+}
+
+func parseRepoConfig(b []byte) (*repoConfig, error) {
+	c := &repoConfig{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, err
+	}
+	if len(c.Regexp) > 0 {
+		re, err := regexp.Compile(c.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling regular expression %s: %v", c.Regexp, err)
+		}
+		c.re = re
+	}
+	if err := ValidateMessage(c.ErrorMessage); err != nil {
+		return nil, fmt.Errorf("error_message: %v", err)
+	}
+	if err := ValidateSeverity(c.Severity); err != nil {
+		return nil, err
+	}
+	if _, err := ParseEffectiveFrom(c.EffectiveFrom); err != nil {
+		return nil, fmt.Errorf("effective_from: %v", err)
+	}
+	if err := ValidateRules(c.Rules); err != nil {
+		return nil, err
+	}
+	if err := ValidateEscalation(c.Escalation); err != nil {
+		return nil, fmt.Errorf("escalation: %v", err)
+	}
+	return c, nil
+}
+
+// merge returns the config resulting from overriding the fields of c that
+// aren't locked with the ones set in the repo file.
+func (c *pluginConfig) merge(rc *repoConfig) *pluginConfig {
+	if rc == nil {
+		return c
+	}
+	s := c.settings
+	for _, field := range rc.overrides() {
+		if c.locked[field] {
+			continue
+		}
+		switch field {
+		case LockedRegexp:
+			s.Regexp = rc.re
+		case LockedErrorMessage:
+			s.ErrorMessage = rc.ErrorMessage
+		case LockedSeverity:
+			s.Severity = rc.Severity
+		case LockedEffectiveFrom:
+			s.EffectiveFrom = rc.EffectiveFrom
+		case LockedRules:
+			s.Rules = rc.Rules
+		case LockedWarningLabel:
+			s.WarningLabel = rc.WarningLabel
+		case LockedExamples:
+			s.Examples = rc.Examples
+		case LockedDocsURL:
+			s.DocsURL = rc.DocsURL
+		case LockedEscalation:
+			s.Escalation = rc.Escalation
+		}
+	}
+	return newPluginConfig(s)
+}
+
+// overrides returns the fields set in the repo file.
+func (rc *repoConfig) overrides() []string {
+	var fields []string
+	if rc.re != nil {
+		fields = append(fields, LockedRegexp)
+	}
+	if len(rc.ErrorMessage) > 0 {
+		fields = append(fields, LockedErrorMessage)
+	}
+	if len(rc.Severity) > 0 {
+		fields = append(fields, LockedSeverity)
+	}
+	if len(rc.EffectiveFrom) > 0 {
+		fields = append(fields, LockedEffectiveFrom)
+	}
+	if len(rc.Rules) > 0 {
+		fields = append(fields, LockedRules)
+	}
+	if len(rc.WarningLabel) > 0 {
+		fields = append(fields, LockedWarningLabel)
+	}
+	if len(rc.Examples) > 0 {
+		fields = append(fields, LockedExamples)
+	}
+	if len(rc.DocsURL) > 0 {
+		fields = append(fields, LockedDocsURL)
+	}
+	if rc.Escalation != nil {
+		fields = append(fields, LockedEscalation)
+	}
+	return fields
+}
+
+// overridesLocked returns the locked fields of c set in the repo file.
+func (c *pluginConfig) overridesLocked(rc *repoConfig) []string {
+	var fields []string
+	for _, field := range rc.overrides() {
+		if c.locked[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// configAt returns the effective config for PRs against the base branch of
+// org/repo at commit sha, it returns nil if the plugin isn't configured.
+func (p *Plugin) configAt(org, repo, sha string) *pluginConfig {
+	c := p.GetConfig()
+	if c == nil {
+		return nil
+	}
+	rc, _, _ := p.repoConfigs.get(org, repo, sha)
+	return c.merge(rc)
+}
+
+// effectiveConfig loads the title policy file of org/repo at the commit sha
+// of branch and returns the effective config for PR num. If the file is
+// malformed, the PR is told with a comment and the central config is
+// returned. Once the file can be used again the comment is pruned.
+func (p *Plugin) effectiveConfig(log *logrus.Entry, ghc githubClient, org, repo string, num int, branch, sha string) (*pluginConfig, error) {
+	if err := p.loadRepoConfig(log, ghc, org, repo, branch, sha); err != nil {
+		var repoErr *RepoConfigError
+		if !errors.As(err, &repoErr) {
+			return nil, err
+		}
+		if err := p.reportRepoConfigError(log, ghc, org, repo, num, repoErr); err != nil {
+			return nil, err
+		}
+	} else if err := p.pruneRepoConfigError(log, ghc, org, repo, num); err != nil {
+		return nil, err
+	}
+	return p.configAt(org, repo, sha), nil
+}
+
+// isRepoConfigError returns true for the comments of the bot telling the PR
+// that the title policy file of its repo can't be used.
+func isRepoConfigError(ic github.IssueComment) bool {
+	return strings.HasPrefix(ic.Body, repoConfigErrorMarker)
+}
+
+// reportRepoConfigError comments on the PR that the title policy file of its
+// repo is malformed, unless the bot already did with the same error. Comments
+// about earlier errors are replaced.
+func (p *Plugin) reportRepoConfigError(log *logrus.Entry, ghc githubClient, org, repo string, num int, repoErr *RepoConfigError) error {
+	log.WithError(repoErr).Warn("Checking PR with the central rules.")
+	_, comments, err := p.botComments(log, ghc, org, repo, num)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s\nThe title policy file `%s` in the base branch at %s can't be used, so this PR is checked with the central rules:\n\n```\n%v\n```", repoConfigErrorMarker, RepoConfigPath, repoErr.SHA, repoErr.Err)
+	commented := false
+	stale := map[int]bool{}
+	for _, ic := range comments {
+		if !isRepoConfigError(ic) {
+			continue
+		}
+		if ic.Body == body && !commented {
+			commented = true
+		} else {
+			stale[ic.ID] = true
+		}
+	}
+	if commented && len(stale) == 0 {
+		return nil
+	}
+
+	c := p.GetConfig()
+	pr := prContext{Org: org, Repo: repo, Number: num}
+	if p.DryRun() || (c != nil && c.shadow(org, repo)) {
+		log.Info("Planned comment about the title policy file.")
+		if !commented {
+			p.writeAudit(log, c, pr, ActionCreateComment, RepoConfigPath, nil)
+		}
+		if len(stale) > 0 {
+			p.writeAudit(log, c, pr, ActionPruneComments, RepoConfigPath, nil)
+		}
+		return nil
+	}
+	p.comments.forget(org, repo, num)
+	if !commented {
+		if err := retry(log, "create_comment", func() error {
+			return ghc.CreateComment(org, repo, num, body)
+		}); err != nil {
+			return err
+		}
+		metrics.Comments.WithLabelValues("created").Inc()
+		p.writeAudit(log, c, pr, ActionCreateComment, RepoConfigPath, nil)
+	}
+	if len(stale) > 0 {
+		return p.deleteRepoConfigErrors(log, ghc, c, pr, comments, func(ic github.IssueComment) bool { return stale[ic.ID] })
+	}
+	return nil
+}
+
+// pruneRepoConfigError deletes the comments of the bot telling the PR that
+// the title policy file of its repo can't be used, if it has any.
+func (p *Plugin) pruneRepoConfigError(log *logrus.Entry, ghc githubClient, org, repo string, num int) error {
+	_, comments, err := p.botComments(log, ghc, org, repo, num)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, ic := range comments {
+		found = found || isRepoConfigError(ic)
+	}
+	if !found {
+		return nil
+	}
+
+	c := p.GetConfig()
+	pr := prContext{Org: org, Repo: repo, Number: num}
+	if p.DryRun() || (c != nil && c.shadow(org, repo)) {
+		log.Info("Planned pruning of the comment about the title policy file.")
+		p.writeAudit(log, c, pr, ActionPruneComments, RepoConfigPath, nil)
+		return nil
+	}
+	p.comments.forget(org, repo, num)
+	return p.deleteRepoConfigErrors(log, ghc, c, pr, comments, isRepoConfigError)
+}
+
+// deleteRepoConfigErrors deletes the comments about the title policy file
+// matching isStale.
+func (p *Plugin) deleteRepoConfigErrors(log *logrus.Entry, ghc githubClient, c *pluginConfig, pr prContext, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	deleted := 0
+	if err := retry(log, "delete_stale_comments", func() error {
+		return ghc.DeleteStaleComments(pr.Org, pr.Repo, pr.Number, comments, func(ic github.IssueComment) bool {
+			if isRepoConfigError(ic) && isStale(ic) {
+				deleted++
+				return true
+			}
+			return false
+		})
+	}); err != nil {
+		return err
+	}
+	metrics.Comments.WithLabelValues("deleted").Add(float64(deleted))
+	p.writeAudit(log, c, pr, ActionPruneComments, RepoConfigPath, nil)
+	return nil
+}
@@ -0,0 +1,237 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		file   string
+		locked []string
+
+		expectedRegexp  string
+		expectedMessage string
+		expectComment   bool
+	}{
+		{
+			name:            "no file",
+			expectedRegexp:  "^fix:.*$",
+			expectedMessage: "central message",
+		},
+		{
+			name:            "overrides the central rules",
+			file:            "regexp: \"^feat:.*$\"\nerror_message: repo message\n",
+			expectedRegexp:  "^feat:.*$",
+			expectedMessage: "repo message",
+		},
+		{
+			name:            "locked fields are kept",
+			file:            "regexp: \"^feat:.*$\"\nerror_message: repo message\n",
+			locked:          []string{LockedRegexp},
+			expectedRegexp:  "^fix:.*$",
+			expectedMessage: "repo message",
+		},
+		{
+			name:            "unknown field",
+			file:            "regex: \"^feat:.*$\"\n",
+			expectedRegexp:  "^fix:.*$",
+			expectedMessage: "central message",
+			expectComment:   true,
+		},
+		{
+			name:            "invalid regexp",
+			file:            "regexp: \"(?'bkeh)\"\n",
+			expectedRegexp:  "^fix:.*$",
+			expectedMessage: "central message",
+			expectComment:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testSubject := &Plugin{}
+			testSubject.SetConfig("central message", regexp.MustCompile("^fix:.*$"), tc.locked...)
+			fake := newFakeClient(nil, nil, nil)
+			if len(tc.file) > 0 {
+				fake.files = map[string]string{"org/repo@abc": tc.file}
+			}
+			log := logrus.WithField("plugin", PluginName)
+
+			c, err := testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", "abc")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRegexp, c.re.String())
+			assert.Equal(t, tc.expectedMessage, c.errorMessage)
+			assert.Equal(t, tc.expectComment, fake.commentCreated[testKey("org", "repo", 1)])
+
+			// The file is cached by commit and errors aren't reported twice.
+			fake.commentCreated = map[string]bool{}
+			fake.comments = []github.IssueComment{{User: github.User{Login: "me"}, Body: fake.lastComment}}
+			c, err = testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", "abc")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRegexp, c.re.String())
+			assert.Equal(t, 1, fake.fileRequests)
+			assert.False(t, fake.commentCreated[testKey("org", "repo", 1)])
+			if tc.expectComment {
+				assert.Contains(t, fake.lastComment, RepoConfigPath)
+			}
+
+			// Titles are checked with the rules at the last commit seen when
+			// no commit is given.
+			rules, err := testSubject.RulesFor("org", "repo", "main")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRegexp, rules.Regexp)
+			evaluation, err := testSubject.Evaluate("org", "repo", "main", "fix: it")
+			assert.NoError(t, err)
+			if len(tc.file) == 0 || tc.expectComment {
+				assert.Equal(t, PolicyCentral, evaluation.Policy)
+			} else {
+				assert.Equal(t, PolicyRepo, evaluation.Policy)
+			}
+			// The central rules are used for branches without a file loaded.
+			evaluation, err = testSubject.Evaluate("org", "repo", "other", "fix: it")
+			assert.NoError(t, err)
+			assert.Equal(t, PolicyCentralFallback, evaluation.Policy)
+		})
+	}
+}
+
+func TestEffectiveConfigPrunesError(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("central message", regexp.MustCompile("^fix:.*$"))
+	sink := &memSink{}
+	testSubject.SetAuditSink(sink)
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+	fake := newFakeClient(nil, nil, nil)
+	fake.files = map[string]string{
+		"org/repo@abc": "regex: \"^feat:.*$\"\n",
+		"org/repo@def": "regexp: \"^feat:.*$\"\n",
+	}
+
+	_, err := testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", "abc")
+	assert.NoError(t, err)
+	assert.True(t, fake.commentCreated[key])
+	assert.False(t, fake.commentDeleted[key])
+
+	// Once the file is fixed the comment is pruned, only once.
+	fake.comments = []github.IssueComment{{User: github.User{Login: "me"}, Body: fake.lastComment}}
+	c, err := testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", "def")
+	assert.NoError(t, err)
+	assert.Equal(t, "^feat:.*$", c.re.String())
+	assert.True(t, fake.commentDeleted[key])
+
+	fake.comments = nil
+	fake.commentDeleted = map[string]bool{}
+	_, err = testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", "def")
+	assert.NoError(t, err)
+	assert.False(t, fake.commentDeleted[key])
+
+	if assert.Len(t, sink.records, 2) {
+		assert.Equal(t, string(ActionCreateComment), sink.records[0].Action)
+		assert.Equal(t, RepoConfigPath, sink.records[0].Detail)
+		assert.Equal(t, string(ActionPruneComments), sink.records[1].Action)
+		assert.Equal(t, 1, sink.records[1].Number)
+	}
+}
+
+func TestRepoConfigErrorComments(t *testing.T) {
+	log := logrus.WithField("plugin", PluginName)
+	key := testKey("org", "repo", 1)
+	files := map[string]string{
+		"org/repo@abc": "regex: \"^feat:.*$\"\n",
+		"org/repo@def": "regexp: \"^feat:.*$\"\n",
+	}
+	first := &Plugin{}
+	first.SetConfig("central message", regexp.MustCompile("^fix:.*$"))
+	fake := newFakeClient(nil, nil, nil)
+	fake.files = files
+	_, err := first.effectiveConfig(log, fake, "org", "repo", 1, "main", "abc")
+	assert.NoError(t, err)
+	// errorComment is the comment about the broken file at abc.
+	errorComment := fake.lastComment
+
+	testCases := []struct {
+		name     string
+		sha      string
+		comments []github.IssueComment
+
+		expectComment  bool
+		expectDeletion bool
+	}{
+		{
+			name:           "fixed after a restart",
+			sha:            "def",
+			comments:       []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: errorComment}},
+			expectDeletion: true,
+		},
+		{
+			name:     "someone else's comment isn't pruned",
+			sha:      "def",
+			comments: []github.IssueComment{{ID: 1, User: github.User{Login: "someone"}, Body: errorComment}},
+		},
+		{
+			name:     "already reported",
+			sha:      "abc",
+			comments: []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: errorComment}},
+		},
+		{
+			name:          "quoted by someone else",
+			sha:           "abc",
+			comments:      []github.IssueComment{{ID: 1, User: github.User{Login: "someone"}, Body: errorComment}},
+			expectComment: true,
+		},
+		{
+			name:           "earlier error replaced",
+			sha:            "abc",
+			comments:       []github.IssueComment{{ID: 1, User: github.User{Login: "me"}, Body: repoConfigErrorMarker + "\nan earlier error"}},
+			expectComment:  true,
+			expectDeletion: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testSubject := &Plugin{}
+			testSubject.SetConfig("central message", regexp.MustCompile("^fix:.*$"))
+			fake := newFakeClient(nil, nil, nil)
+			fake.files = files
+			fake.comments = tc.comments
+
+			_, err := testSubject.effectiveConfig(log, fake, "org", "repo", 1, "main", tc.sha)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectComment, fake.commentCreated[key])
+			assert.Equal(t, tc.expectDeletion, fake.commentDeleted[key])
+			if tc.expectComment {
+				assert.Equal(t, errorComment, fake.lastComment)
+			}
+		})
+	}
+}
+
+func TestRepoConfigCache(t *testing.T) {
+	rc := &repoConfigCache{}
+	for i := 0; i <= repoConfigCacheSize; i++ {
+		rc.put("org", "repo", fmt.Sprintf("sha%d", i), &repoConfig{}, nil)
+		if i == 0 {
+			rc.seen("org", "repo", "old", "sha0")
+		}
+		// The first commit stays in use, so the second one is evicted.
+		_, _, ok := rc.get("org", "repo", "sha0")
+		assert.True(t, ok)
+	}
+	_, _, ok := rc.get("org", "repo", "sha1")
+	assert.False(t, ok)
+	_, _, ok = rc.get("org", "repo", fmt.Sprintf("sha%d", repoConfigCacheSize))
+	assert.True(t, ok)
+	c, ok := rc.latest("org", "repo", "old")
+	assert.True(t, ok)
+	assert.NotNil(t, c)
+}
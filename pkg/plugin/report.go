@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// ReportEntry is the compliance state of an open PR.
+type ReportEntry struct {
+	Repo         string   `json:"repo"`
+	Number       int      `json:"number"`
+	Author       string   `json:"author"`
+	Title        string   `json:"title"`
+	Verdict      string   `json:"verdict"`
+	FailingRules []string `json:"failing_rules"`
+	LabelCorrect bool     `json:"label_correct"`
+}
+
+// Report evaluates the open PRs within the scope without changing them. It
+// returns the compliance state of every PR, including whether the
+// "needs-retitle" label currently matches the verdict.
+func (p *Plugin) Report(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, scope Scope) ([]ReportEntry, error) {
+	if p.GetConfig() == nil {
+		return nil, ErrNotConfigured
+	}
+
+	orgs, repos := config.EnabledReposForExternalPlugin(PluginName)
+	if len(orgs) == 0 && len(repos) == 0 {
+		log.Warnf("No repos have been configured for the %s plugin", PluginName)
+		return nil, nil
+	}
+	if err := scope.Validate(orgs, repos); err != nil {
+		return nil, err
+	}
+
+	var entries []ReportEntry
+	err := searchPartitioned(context.Background(), log, ghc, scope.baseQuery(), scope.partition(orgs, repos), p.GetScanOptions().MinRateLimit, func(pr pullRequest) {
+		org := string(pr.Repository.Owner.Login)
+		repo := string(pr.Repository.Name)
+		num := int(pr.Number)
+		if scope.Number > 0 && num != scope.Number {
+			return
+		}
+		title := string(pr.Title)
+		sha := string(pr.BaseRefOid)
+		if err := p.loadRepoConfig(log, ghc, org, repo, string(pr.BaseRefName), sha); err != nil {
+			log.WithError(err).Warnf("Error loading %s, using the central rules for %s/%s#%d.", RepoConfigPath, org, repo, num)
+		}
+		evaluation := p.configAt(org, repo, sha).evaluate(prContext{
+			Org:        org,
+			Repo:       repo,
+			Number:     num,
+			Author:     string(pr.Author.Login),
+			Title:      title,
+			BaseBranch: string(pr.BaseRefName),
+			CreatedAt:  pr.CreatedAt.Time,
+		})
+		entry := ReportEntry{
+			Repo:         org + "/" + repo,
+			Number:       num,
+			Author:       string(pr.Author.Login),
+			Title:        title,
+			Verdict:      evaluation.Verdict,
+			FailingRules: []string{},
+			LabelCorrect: pr.hasLabel(needsRetitleLabel) != evaluation.Passed(),
+		}
+		for _, f := range evaluation.Failures {
+			entry.FailingRules = append(entry.FailingRules, f.Rule)
+		}
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		metrics.GitHubErrors.WithLabelValues("search").Inc()
+		return nil, err
+	}
+	return entries, nil
+}
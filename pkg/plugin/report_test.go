@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestReport(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+
+	testPRs := []struct {
+		title  string
+		labels []string
+	}{
+		{title: "fix: valid title"},
+		{title: "feat: valid title", labels: []string{needsRetitleLabel}},
+		{title: "wrong title"},
+		{title: "wrong title", labels: []string{needsRetitleLabel}},
+	}
+	var prs []pullRequest
+	for i, testPR := range testPRs {
+		pr := pullRequest{Number: githubql.Int(i), Title: githubql.String(testPR.title)}
+		pr.Repository.Name = "repo"
+		pr.Repository.Owner.Login = "org"
+		pr.Author.Login = "author"
+		for _, label := range testPR.labels {
+			pr.Labels.Nodes = append(pr.Labels.Nodes, struct{ Name githubql.String }{githubql.String(label)})
+		}
+		prs = append(prs, pr)
+	}
+	fake := newFakeClient(prs, nil, nil)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+
+	entries, err := testSubject.Report(logrus.WithField("plugin", PluginName), fake, config, Scope{})
+	assert.NoError(t, err)
+	assert.Equal(t, []ReportEntry{
+		{Repo: "org/repo", Number: 0, Author: "author", Title: "fix: valid title", Verdict: VerdictPass, FailingRules: []string{}, LabelCorrect: true},
+		{Repo: "org/repo", Number: 1, Author: "author", Title: "feat: valid title", Verdict: VerdictPass, FailingRules: []string{}, LabelCorrect: false},
+		{Repo: "org/repo", Number: 2, Author: "author", Title: "wrong title", Verdict: VerdictFail, FailingRules: []string{regexpRule}, LabelCorrect: false},
+		{Repo: "org/repo", Number: 3, Author: "author", Title: "wrong title", Verdict: VerdictFail, FailingRules: []string{regexpRule}, LabelCorrect: true},
+	}, entries)
+	for i := range testPRs {
+		fake.compareExpected(t, "org", "repo", i, nil, nil, false, false)
+	}
+}
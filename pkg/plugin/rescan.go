@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// Rescanner scans orgs and repos once no more scans have been requested for
+// a while, so requests made in quick succession lead to a single scan.
+type Rescanner struct {
+	mut          sync.Mutex
+	log          *logrus.Entry
+	ghc          githubClient
+	p            *Plugin
+	pluginConfig func() *plugins.Configuration
+	debounce     time.Duration
+	pending      map[string]bool
+	timer        *time.Timer
+}
+
+func NewRescanner(log *logrus.Entry, ghc githubClient, p *Plugin, pluginConfig func() *plugins.Configuration, debounce time.Duration) *Rescanner {
+	return &Rescanner{
+		log:          log,
+		ghc:          ghc,
+		p:            p,
+		pluginConfig: pluginConfig,
+		debounce:     debounce,
+		pending:      map[string]bool{},
+	}
+}
+
+// Trigger requests a scan of the orgs and org/repos in keys. The scan runs
+// after debounce passes without another request.
+func (r *Rescanner) Trigger(keys []string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for _, key := range keys {
+		r.pending[key] = true
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(r.debounce, r.run)
+}
+
+func (r *Rescanner) run() {
+	r.mut.Lock()
+	var keys []string
+	for key := range r.pending {
+		keys = append(keys, key)
+	}
+	r.pending = map[string]bool{}
+	r.timer = nil
+	r.mut.Unlock()
+	sort.Strings(keys)
+
+	config := r.pluginConfig()
+	for i, key := range keys {
+		scope := Scope{Org: key}
+		if parts := strings.SplitN(key, "/", 2); len(parts) == 2 {
+			scope = Scope{Org: parts[0], Repo: parts[1]}
+		}
+		r.log.WithField("scope", scope.String()).Info("Rescanning after a rule change.")
+		result, err := r.p.Scan(r.log, r.ghc, config, scope)
+		if errors.Is(err, ErrScanInProgress) {
+			r.log.Info("A scan is already in progress, rescanning later.")
+			r.Trigger(keys[i:])
+			return
+		}
+		if err == nil {
+			err = result.Err()
+		}
+		if err != nil {
+			r.log.WithError(err).WithField("scope", scope.String()).Error("Error rescanning after a rule change.")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestRescanner(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+	fake := newFakeClient(nil, nil, nil)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{
+			"org":        {{Name: PluginName}},
+			"other/repo": {{Name: PluginName}},
+		},
+	}
+	r := NewRescanner(logrus.WithField("plugin", PluginName), fake, testSubject, func() *plugins.Configuration { return config }, 50*time.Millisecond)
+
+	r.Trigger([]string{"org"})
+	r.Trigger([]string{"org", "other/repo"})
+
+	queries := func() []string {
+		fake.Lock()
+		defer fake.Unlock()
+		return append([]string(nil), fake.queries...)
+	}
+	assert.Eventually(t, func() bool { return len(queries()) == 2 }, time.Second, 10*time.Millisecond)
+	// Give a second timer the chance to fire if the requests weren't merged.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{
+		`archived:false is:pr is:open org:"org"`,
+		`archived:false is:pr is:open repo:"other/repo"`,
+	}, queries())
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// retryAttempts is the number of times a GitHub call is tried before
+	// giving up.
+	retryAttempts = 3
+	// retryBackoff is the wait after the first failed attempt, it doubles
+	// after each failure.
+	retryBackoff = 2 * time.Second
+)
+
+// statusCodeRe matches the status code in the errors of the GitHub client
+// for unexpected responses.
+var statusCodeRe = regexp.MustCompile(`status code (\d{3})`)
+
+// retry calls fn until it succeeds, it fails with an error that isn't
+// transient, or it fails retryAttempts times, backing off exponentially
+// between attempts. Failures are counted in the GitHub errors metric with op
+// as the operation. It returns the last error.
+func retry(log *logrus.Entry, op string, fn func() error) error {
+	backoff := retryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		metrics.GitHubErrors.WithLabelValues(op).Inc()
+		if attempt == retryAttempts || !transient(err) {
+			return err
+		}
+		log.WithError(err).Warnf("Attempt %d of %d of %s failed, retrying in %v.", attempt, retryAttempts, op, backoff)
+		sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// transient returns true if the error may go away by trying again: server
+// errors, secondary rate limits and errors without a status code, like
+// network errors. Other client errors, like 403, 404 or 422, won't.
+func transient(err error) bool {
+	var labelNotFound *github.LabelNotFound
+	if errors.As(err, &labelNotFound) {
+		return false
+	}
+	msg := err.Error()
+	if strings.Contains(strings.ToLower(msg), "secondary rate limit") {
+		return true
+	}
+	m := statusCodeRe.FindStringSubmatch(msg)
+	if m == nil {
+		return true
+	}
+	code, _ := strconv.Atoi(m[1])
+	return code >= 500 || code == 429
+}
+
+// removeLabel removes the label from the PR, a label the PR doesn't carry
+// counts as removed.
+func removeLabel(ghc githubClient, org, repo string, num int, label string) error {
+	err := ghc.RemoveLabel(org, repo, num, label)
+	var labelNotFound *github.LabelNotFound
+	if errors.As(err, &labelNotFound) {
+		return nil
+	}
+	return err
+}
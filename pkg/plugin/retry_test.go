@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestTransient(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "network error",
+			err:       errors.New("dial tcp: connection reset by peer"),
+			transient: true,
+		},
+		{
+			name:      "server error",
+			err:       errors.New("status code 502 not one of [200], body: Bad Gateway"),
+			transient: true,
+		},
+		{
+			name:      "secondary rate limit",
+			err:       errors.New("status code 403 not one of [200], body: You have exceeded a secondary rate limit"),
+			transient: true,
+		},
+		{
+			name:      "too many requests",
+			err:       errors.New("status code 429 not one of [200], body: "),
+			transient: true,
+		},
+		{
+			name:      "forbidden",
+			err:       errors.New("status code 403 not one of [200], body: Resource not accessible by integration"),
+			transient: false,
+		},
+		{
+			name:      "not found",
+			err:       fmt.Errorf("listing comments: %w", errors.New("status code 404 not one of [200], body: Not Found")),
+			transient: false,
+		},
+		{
+			name:      "unprocessable",
+			err:       errors.New("status code 422 not one of [201], body: Validation Failed"),
+			transient: false,
+		},
+		{
+			name:      "label not found",
+			err:       &github.LabelNotFound{Owner: "org", Repo: "repo", Number: 1, Label: needsRetitleLabel},
+			transient: false,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.transient, transient(tc.err))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/checkpoint"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// ErrScanInProgress is returned when a scan is requested while another one
+// is still running.
+var ErrScanInProgress = errors.New("a scan is already in progress")
+
+// ScanOptions tunes how scans use the GitHub API.
+type ScanOptions struct {
+	// Parallelism is the number of PRs handled at the same time.
+	Parallelism int
+	// MinRateLimit is the number of GraphQL rate limit points under which
+	// scans pause until the rate limit resets.
+	MinRateLimit int
+}
+
+// Scope limits a scan to an org, a repo or a single PR. The zero value
+// covers all orgs and repos that enabled the plugin.
+type Scope struct {
+	Org    string `json:"org,omitempty"`
+	Repo   string `json:"repo,omitempty"`
+	Number int    `json:"number,omitempty"`
+	// UpdatedSince limits the scope to the PRs updated since then, when set.
+	UpdatedSince time.Time `json:"updated_since,omitempty"`
+}
+
+// IsAll returns true if the scope covers every enabled org and repo.
+func (s Scope) IsAll() bool {
+	return len(s.Org) == 0 && len(s.Repo) == 0 && s.Number == 0
+}
+
+// IsIncremental returns true if the scope only covers recently updated PRs.
+func (s Scope) IsIncremental() bool {
+	return !s.UpdatedSince.IsZero()
+}
+
+func (s Scope) String() string {
+	var str string
+	switch {
+	case s.IsAll():
+		str = "all"
+	case s.Number > 0:
+		str = fmt.Sprintf("%s/%s#%d", s.Org, s.Repo, s.Number)
+	case len(s.Repo) > 0:
+		str = s.Org + "/" + s.Repo
+	default:
+		str = s.Org
+	}
+	if s.IsIncremental() {
+		str += " updated since " + s.UpdatedSince.UTC().Format(time.RFC3339)
+	}
+	return str
+}
+
+// Validate checks the scope is well formed and only covers orgs and repos
+// that enabled the plugin.
+func (s Scope) Validate(orgs, repos []string) error {
+	if s.IsAll() {
+		return nil
+	}
+	if len(s.Org) == 0 {
+		return errors.New("an org is required")
+	}
+	if s.Number < 0 {
+		return fmt.Errorf("invalid PR number %d", s.Number)
+	}
+	if s.Number > 0 && len(s.Repo) == 0 {
+		return errors.New("a repo is required to check a single PR")
+	}
+	for _, org := range orgs {
+		if org == s.Org {
+			return nil
+		}
+	}
+	for _, repo := range repos {
+		if len(s.Repo) > 0 && repo == s.Org+"/"+s.Repo {
+			return nil
+		}
+		if len(s.Repo) == 0 && strings.HasPrefix(repo, s.Org+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("the %s plugin is not enabled for %s", PluginName, s)
+}
+
+// baseQuery returns the search query for the open PRs within the scope,
+// without the org and repo qualifiers.
+func (s Scope) baseQuery() string {
+	q := "archived:false is:pr is:open"
+	if s.IsIncremental() {
+		q += " updated:>=" + s.UpdatedSince.UTC().Format(time.RFC3339)
+	}
+	return q
+}
+
+// partition returns the orgs and repos within the scope.
+func (s Scope) partition(orgs, repos []string) partition {
+	if len(s.Repo) > 0 {
+		return partition{repos: []string{s.Org + "/" + s.Repo}}
+	}
+	var pt partition
+	for _, org := range orgs {
+		if len(s.Org) == 0 || org == s.Org {
+			pt.orgs = append(pt.orgs, org)
+		}
+	}
+	for _, repo := range repos {
+		if len(s.Org) == 0 || strings.HasPrefix(repo, s.Org+"/") {
+			pt.repos = append(pt.repos, repo)
+		}
+	}
+	return pt
+}
+
+// query returns the search query for the open PRs within the scope.
+func (s Scope) query(orgs, repos []string) string {
+	return s.partition(orgs, repos).query(s.baseQuery())
+}
+
+// ActionType is a kind of change made to a PR.
+type ActionType string
+
+const (
+	ActionAddLabel      ActionType = "add_label"
+	ActionRemoveLabel   ActionType = "remove_label"
+	ActionCreateComment ActionType = "create_comment"
+	ActionPruneComments ActionType = "prune_comments"
+)
+
+// Action is a change made to a PR.
+type Action struct {
+	Org    string     `json:"org"`
+	Repo   string     `json:"repo"`
+	Number int        `json:"number"`
+	Type   ActionType `json:"type"`
+	Label  string     `json:"label,omitempty"`
+	// Step is the escalation step taken.
+	Step string `json:"step,omitempty"`
+}
+
+// ScanResult summarises the PRs checked during a scan, the actions taken
+// and the errors found handling PRs, keyed by org/repo. In dry run the
+// actions are the ones that would have been taken. Plans holds the plan of
+// each PR checked in dry run or in shadow mode.
+type ScanResult struct {
+	DryRun  bool                `json:"dry_run,omitempty"`
+	Checked int                 `json:"checked"`
+	Actions []Action            `json:"actions"`
+	Errors  map[string][]string `json:"errors,omitempty"`
+	Plans   []Plan              `json:"plans,omitempty"`
+
+	// failed are the PRs that couldn't be handled.
+	failed []checkpoint.PR
+}
+
+func (r *ScanResult) addError(org, repo string, num int, err error) {
+	if r.Errors == nil {
+		r.Errors = map[string][]string{}
+	}
+	key := org + "/" + repo
+	r.Errors[key] = append(r.Errors[key], fmt.Sprintf("#%d: %v", num, err))
+	r.failed = append(r.failed, checkpoint.PR{Org: org, Repo: repo, Number: num})
+}
+
+// merge adds the PRs checked by another scan to the result.
+func (r *ScanResult) merge(other *ScanResult) {
+	r.Checked += other.Checked
+	r.Actions = append(r.Actions, other.Actions...)
+	r.Plans = append(r.Plans, other.Plans...)
+	for key, errs := range other.Errors {
+		if r.Errors == nil {
+			r.Errors = map[string][]string{}
+		}
+		r.Errors[key] = append(r.Errors[key], errs...)
+	}
+	r.failed = append(r.failed, other.failed...)
+}
+
+// Failed returns the number of PRs that couldn't be handled.
+func (r *ScanResult) Failed() int {
+	failed := 0
+	for _, errs := range r.Errors {
+		failed += len(errs)
+	}
+	return failed
+}
+
+// Err returns an error if any PR couldn't be handled.
+func (r *ScanResult) Err() error {
+	if failed := r.Failed(); failed > 0 {
+		return fmt.Errorf("failed to handle %d PR(s) in %d repo(s)", failed, len(r.Errors))
+	}
+	return nil
+}
+
+// HandlePeriodic runs a periodic scan with ScanPeriodic. It returns an
+// error if the scan fails or if any PR couldn't be handled.
+func (p *Plugin) HandlePeriodic(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, store checkpoint.Store, fullScanPeriod time.Duration) error {
+	result, err := p.ScanPeriodic(log, ghc, config, store, fullScanPeriod)
+	if err != nil {
+		return err
+	}
+	if err := p.FollowUp(log, ghc, config, store); err != nil {
+		log.WithError(err).Error("Error following up on labelled PRs.")
+	}
+	return result.Err()
+}
+
+// ScanPeriodic runs a periodic scan. When the last scan is recorded in the
+// checkpoint store, and the last full scan is more recent than
+// fullScanPeriod, only the PRs updated since the last scan are checked,
+// along with the PRs the last scan couldn't handle, otherwise all open PRs
+// are. The checkpoint is updated unless the search fails, recording the PRs
+// that couldn't be handled so the next scan checks them again. In dry run
+// it's left as it is, so the first scan once changes are made checks the
+// PRs that were only planned. Repos switched from shadow to enforce are
+// rescanned on the config reload.
+func (p *Plugin) ScanPeriodic(log *logrus.Entry, ghc githubClient, config *plugins.Configuration, store checkpoint.Store, fullScanPeriod time.Duration) (*ScanResult, error) {
+	log = withScanID(log)
+	start := time.Now()
+	cp, err := store.Load()
+	if err != nil {
+		log.WithError(err).Warn("Error loading the scan checkpoint, running a full scan.")
+		cp = &checkpoint.Checkpoint{}
+	}
+
+	scope := Scope{}
+	if !cp.LastScan.IsZero() && start.Sub(cp.LastFullScan) < fullScanPeriod {
+		scope.UpdatedSince = cp.LastScan
+	}
+
+	result, err := p.Scan(log, ghc, config, scope)
+	if err != nil {
+		return result, err
+	}
+	if scope.IsIncremental() {
+		// PRs that failed may not have been updated since, so they're
+		// checked on their own, unless they just failed again. Full scans
+		// check them anyway.
+		failedAgain := map[checkpoint.PR]bool{}
+		for _, pr := range result.failed {
+			failedAgain[pr] = true
+		}
+		for _, pr := range cp.Failed {
+			if failedAgain[pr] {
+				continue
+			}
+			retried, err := p.Scan(log, ghc, config, Scope{Org: pr.Org, Repo: pr.Repo, Number: pr.Number})
+			if errors.Is(err, ErrScanInProgress) {
+				result.addError(pr.Org, pr.Repo, pr.Number, err)
+				continue
+			} else if err != nil {
+				log.WithError(err).Warnf("Not checking %s/%s#%d again.", pr.Org, pr.Repo, pr.Number)
+				continue
+			}
+			result.merge(retried)
+		}
+	}
+
+	if p.DryRun() {
+		return result, nil
+	}
+	cp.LastScan = start
+	if !scope.IsIncremental() {
+		cp.LastFullScan = start
+	}
+	cp.Failed = result.failed
+	return result, store.Save(cp)
+}
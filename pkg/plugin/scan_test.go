@@ -0,0 +1,304 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/checkpoint"
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestScope(t *testing.T) {
+	orgs := []string{"org"}
+	repos := []string{"other/repo"}
+
+	testCases := []struct {
+		name  string
+		scope Scope
+
+		expectedErr   bool
+		expectedQuery string
+	}{
+		{
+			name:          "all",
+			expectedQuery: `archived:false is:pr is:open org:"org" repo:"other/repo"`,
+		},
+		{
+			name:          "enabled org",
+			scope:         Scope{Org: "org"},
+			expectedQuery: `archived:false is:pr is:open org:"org"`,
+		},
+		{
+			name:          "org with enabled repos",
+			scope:         Scope{Org: "other"},
+			expectedQuery: `archived:false is:pr is:open repo:"other/repo"`,
+		},
+		{
+			name:          "repo in enabled org",
+			scope:         Scope{Org: "org", Repo: "foo"},
+			expectedQuery: `archived:false is:pr is:open repo:"org/foo"`,
+		},
+		{
+			name:        "repo not enabled",
+			scope:       Scope{Org: "other", Repo: "foo"},
+			expectedErr: true,
+		},
+		{
+			name:        "org not enabled",
+			scope:       Scope{Org: "foo"},
+			expectedErr: true,
+		},
+		{
+			name:        "pr without repo",
+			scope:       Scope{Org: "org", Number: 5},
+			expectedErr: true,
+		},
+		{
+			name:        "repo without org",
+			scope:       Scope{Repo: "repo"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.scope.Validate(orgs, repos)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedQuery, tc.scope.query(orgs, repos))
+		})
+	}
+}
+
+func TestScanInProgress(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.scanMut.Lock()
+	defer testSubject.scanMut.Unlock()
+
+	_, err := testSubject.Scan(logrus.WithField("plugin", PluginName), newFakeClient(nil, nil, nil), &plugins.Configuration{}, Scope{})
+	if !errors.Is(err, ErrScanInProgress) {
+		t.Errorf("Expected %v, but got %v.", ErrScanInProgress, err)
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) { return }
+	defer func() { sleep = oldSleep }()
+
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+
+	prs := []pullRequest{
+		{Number: 1, Title: "fix: this is a valid title"},
+		{Number: 2, Title: "this title is wrong"},
+	}
+	for i := range prs {
+		prs[i].Repository.Name = "repo"
+		prs[i].Repository.Owner.Login = "org"
+	}
+	fake := newFakeClient(prs, nil, nil)
+	fake.createCommentErr = errors.New("injected error")
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+
+	result, err := testSubject.Scan(logrus.WithField("plugin", PluginName), fake, config, Scope{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Checked)
+	assert.Equal(t, map[string][]string{"org/repo": {"#2: creating comment: injected error"}}, result.Errors)
+	assert.Error(t, result.Err())
+	// The label is added before the comment is posted.
+	assert.Equal(t, map[string][]string{"org/repo#2": {needsRetitleLabel}}, fake.IssueLabelsAdded)
+
+	assert.Error(t, testSubject.HandleAll(logrus.WithField("plugin", PluginName), fake, config))
+}
+
+type pagedClient struct {
+	*fghc
+	remaining int
+	resetAt   time.Time
+	pages     int
+}
+
+func (c *pagedClient) QueryWithGitHubAppsSupport(_ context.Context, q interface{}, vars map[string]interface{}, _ string) error {
+	query, ok := q.(*searchQuery)
+	if !ok {
+		return errors.New("invalid query format")
+	}
+	c.pages++
+	query.RateLimit.Remaining = githubql.Int(c.remaining)
+	query.RateLimit.ResetAt = githubql.DateTime{Time: c.resetAt}
+	query.Search.Nodes = c.allPRs[c.pages-1 : c.pages]
+	query.Search.PageInfo.HasNextPage = githubql.Boolean(c.pages < len(c.allPRs))
+	query.Search.PageInfo.EndCursor = githubql.String(fmt.Sprintf("%d", c.pages))
+	return nil
+}
+
+func TestScanRateLimit(t *testing.T) {
+	var slept []time.Duration
+	oldSleep := sleep
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = oldSleep }()
+
+	testCases := []struct {
+		name      string
+		remaining int
+
+		expectedSleeps int
+	}{
+		{
+			name:      "enough points left",
+			remaining: 1000,
+		},
+		{
+			name:           "pauses until reset",
+			remaining:      10,
+			expectedSleeps: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			slept = nil
+			testSubject := &Plugin{}
+			testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+			testSubject.SetScanOptions(ScanOptions{Parallelism: 2, MinRateLimit: 100})
+			var prs []pullRequest
+			for i := 0; i < 3; i++ {
+				prs = append(prs, pullRequest{Number: githubql.Int(i), Title: "fix: valid title"})
+			}
+			fake := &pagedClient{fghc: newFakeClient(prs, nil, nil), remaining: tc.remaining, resetAt: time.Now().Add(time.Hour)}
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+			}
+
+			result, err := testSubject.Scan(logrus.WithField("plugin", PluginName), fake, config, Scope{})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, result.Checked)
+			assert.Len(t, slept, tc.expectedSleeps)
+			for _, d := range slept {
+				assert.InDelta(t, time.Hour, d, float64(time.Minute))
+			}
+		})
+	}
+}
+
+type memoryStore struct {
+	c checkpoint.Checkpoint
+}
+
+func (s *memoryStore) Load() (*checkpoint.Checkpoint, error) {
+	c := s.c
+	return &c, nil
+}
+
+func (s *memoryStore) Save(c *checkpoint.Checkpoint) error {
+	s.c = *c
+	return nil
+}
+
+func TestHandlePeriodic(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+	log := logrus.WithField("plugin", PluginName)
+	store := &memoryStore{}
+
+	fake := newFakeClient(nil, nil, nil)
+	assert.NoError(t, testSubject.HandlePeriodic(log, fake, config, store, time.Hour))
+	assert.Equal(t, []string{`archived:false is:pr is:open org:"org"`}, fake.queries)
+	assert.False(t, store.c.LastFullScan.IsZero())
+	assert.Equal(t, store.c.LastFullScan, store.c.LastScan)
+
+	lastScan := store.c.LastScan
+	fake = newFakeClient(nil, nil, nil)
+	assert.NoError(t, testSubject.HandlePeriodic(log, fake, config, store, time.Hour))
+	assert.Equal(t, []string{`archived:false is:pr is:open updated:>=` + lastScan.UTC().Format(time.RFC3339) + ` org:"org"`}, fake.queries)
+	assert.True(t, store.c.LastScan.After(store.c.LastFullScan))
+
+	store.c.LastFullScan = store.c.LastFullScan.Add(-2 * time.Hour)
+	fake = newFakeClient(nil, nil, nil)
+	assert.NoError(t, testSubject.HandlePeriodic(log, fake, config, store, time.Hour))
+	assert.Equal(t, []string{`archived:false is:pr is:open org:"org"`}, fake.queries)
+}
+
+func TestScanPeriodicRetriesFailedPRs(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+	log := logrus.WithField("plugin", PluginName)
+	lastScan := time.Now().Add(-time.Minute)
+	store := &memoryStore{c: checkpoint.Checkpoint{LastScan: lastScan, LastFullScan: lastScan}}
+
+	// The checkpoint advances even though the PR couldn't be handled.
+	pr := pullRequest{Number: 1, Title: "bad title"}
+	pr.Repository.Name = "repo"
+	pr.Repository.Owner.Login = "org"
+	fake := newFakeClient([]pullRequest{pr}, nil, nil)
+	fake.addLabelErr = errors.New("status code 403 not one of [200], body: Resource not accessible by integration")
+	result, err := testSubject.ScanPeriodic(log, fake, config, store, time.Hour)
+	assert.NoError(t, err)
+	assert.Error(t, result.Err())
+	assert.True(t, store.c.LastScan.After(lastScan))
+	assert.Equal(t, lastScan, store.c.LastFullScan)
+	assert.Equal(t, []checkpoint.PR{{Org: "org", Repo: "repo", Number: 1}}, store.c.Failed)
+
+	// The next scan checks it again, even if it wasn't updated since.
+	fake = newFakeClient(nil, nil, &github.PullRequest{
+		Base:   github.PullRequestBranch{Repo: github.Repo{Name: "repo", Owner: github.User{Login: "org"}}},
+		Number: 1,
+		State:  "open",
+		Title:  "bad title",
+	})
+	result, err = testSubject.ScanPeriodic(log, fake, config, store, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 1, result.Checked)
+	assert.Equal(t, []string{needsRetitleLabel}, fake.IssueLabelsAdded[testKey("org", "repo", 1)])
+	assert.Empty(t, store.c.Failed)
+}
+
+func TestScanPeriodicDryRun(t *testing.T) {
+	testSubject := &Plugin{}
+	testSubject.SetConfig("", regexp.MustCompile("^(fix:|feat:|major:).*$"))
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: PluginName}}},
+	}
+	log := logrus.WithField("plugin", PluginName)
+	lastScan := time.Now().Add(-time.Minute)
+	store := &memoryStore{c: checkpoint.Checkpoint{LastScan: lastScan, LastFullScan: lastScan}}
+
+	// Scans in dry run leave the checkpoint as it is.
+	testSubject.SetDryRun(true)
+	fake := newFakeClient(nil, nil, nil)
+	_, err := testSubject.ScanPeriodic(log, fake, config, store, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, lastScan, store.c.LastScan)
+	assert.Equal(t, lastScan, store.c.LastFullScan)
+
+	// So the first scan making changes checks the PRs updated during the
+	// dry run.
+	testSubject.SetDryRun(false)
+	fake = newFakeClient(nil, nil, nil)
+	_, err = testSubject.ScanPeriodic(log, fake, config, store, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`archived:false is:pr is:open updated:>=` + lastScan.UTC().Format(time.RFC3339) + ` org:"org"`}, fake.queries)
+	assert.True(t, store.c.LastScan.After(lastScan))
+}
@@ -0,0 +1,254 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/notify"
+)
+
+const (
+	// SeverityError is for rules that block PRs with the "needs-retitle"
+	// label.
+	SeverityError = "error"
+	// SeverityWarning is for rules that are only commented on, and that
+	// add the warning label when one is configured.
+	SeverityWarning = "warning"
+	// SeverityNotice is for rules that only show up when evaluating titles.
+	SeverityNotice = "notice"
+)
+
+// Severities are the valid rule severities.
+var Severities = []string{SeverityError, SeverityWarning, SeverityNotice}
+
+// Settings configures the rules the plugin enforces.
+type Settings struct {
+	// Regexp is the regular expression titles need to match, checked as
+	// the "regexp" rule.
+	Regexp *regexp.Regexp
+	// ErrorMessage is the message for titles that don't match Regexp, it
+	// defaults to a message with the regular expression.
+	ErrorMessage string
+	// Severity is the severity of the "regexp" rule, error if empty.
+	Severity string
+	// EffectiveFrom is when the "regexp" rule takes effect, PRs created
+	// before then are exempt from it. It applies to all PRs if empty.
+	EffectiveFrom string
+	// Rules are checked along with Regexp.
+	Rules []Rule
+	// WarningLabel is added to PRs breaking warning rules. No label is added
+	// if empty.
+	WarningLabel string
+	// LockedFields are the fields the title policy files of repos can't
+	// override.
+	LockedFields []string
+	// Language is the language of the messages, DefaultLanguage if empty.
+	Language string
+	// Languages overrides Language for orgs and org/repos.
+	Languages map[string]string
+	// Messages are the message catalogues keyed by language.
+	Messages map[string]Catalogue
+	// Examples are titles that follow the rules, shown in comments.
+	Examples []string
+	// DocsURL is linked from comments.
+	DocsURL string
+	// MentionAuthor is whether comments mention the author of the PR, true
+	// if nil.
+	MentionAuthor *bool
+	// Notifications configures where PRs that have carried the label for
+	// too long are announced.
+	Notifications notify.Config
+	// Escalation are the steps taken as PRs carry the label for longer.
+	Escalation []EscalationStep
+	// Mode is whether PRs are changed, enforce, or only evaluated, shadow.
+	// It's enforce if empty.
+	Mode string
+	// Modes overrides Mode for orgs and org/repos.
+	Modes map[string]string
+	// ConfigHash identifies the config the settings were loaded from, it's
+	// recorded in the audit log.
+	ConfigHash string
+}
+
+func (s Settings) mentionAuthor() bool {
+	return s.MentionAuthor == nil || *s.MentionAuthor
+}
+
+// Rule is a regular expression titles need to match, checked along with the
+// main one.
+type Rule struct {
+	Name     string `json:"name"`
+	Regexp   string `json:"regexp"`
+	Message  string `json:"message,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	// EffectiveFrom is when the rule takes effect, PRs created before then
+	// are exempt from it.
+	EffectiveFrom string `json:"effective_from,omitempty"`
+}
+
+// ValidateSeverity checks the severity is empty or one of Severities.
+func ValidateSeverity(severity string) error {
+	if len(severity) == 0 {
+		return nil
+	}
+	for _, s := range Severities {
+		if s == severity {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid severity %q, valid severities are %s", severity, strings.Join(Severities, ", "))
+}
+
+// RuleError is a problem with the rule at Index in the rules.
+type RuleError struct {
+	Index int
+	Err   error
+}
+
+func (e *RuleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateRules checks every rule has a unique name, a valid regular
+// expression and a valid severity. It returns a *RuleError for the first
+// rule with a problem.
+func ValidateRules(rules []Rule) error {
+	names := map[string]bool{regexpRule: true}
+	for i, r := range rules {
+		if err := validateRule(i, r, names); err != nil {
+			return &RuleError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// validateRule checks the rule at index i, adding its name to names.
+func validateRule(i int, r Rule, names map[string]bool) error {
+	if len(r.Name) == 0 {
+		return fmt.Errorf("rule %d: a name is required", i)
+	}
+	if names[r.Name] {
+		return fmt.Errorf("rule %d: duplicate name %q", i, r.Name)
+	}
+	names[r.Name] = true
+	if len(r.Regexp) == 0 {
+		return fmt.Errorf("rule %q: a regular expression is required", r.Name)
+	}
+	if _, err := regexp.Compile(r.Regexp); err != nil {
+		return fmt.Errorf("rule %q: %v", r.Name, err)
+	}
+	if err := ValidateSeverity(r.Severity); err != nil {
+		return fmt.Errorf("rule %q: %v", r.Name, err)
+	}
+	if err := ValidateMessage(r.Message); err != nil {
+		return fmt.Errorf("rule %q: message: %v", r.Name, err)
+	}
+	if _, err := ParseEffectiveFrom(r.EffectiveFrom); err != nil {
+		return fmt.Errorf("rule %q: effective_from: %v", r.Name, err)
+	}
+	return nil
+}
+
+// ValidateExamples checks the examples follow the error rules.
+func ValidateExamples(re *regexp.Regexp, rules []Rule, examples []string) error {
+	c := newPluginConfig(Settings{Regexp: re, Rules: rules})
+	for _, example := range examples {
+		for _, f := range c.evaluate(prContext{Title: example}).Failures {
+			if f.Severity == SeverityError {
+				return fmt.Errorf("example %q breaks the %q rule", example, f.Rule)
+			}
+		}
+	}
+	return nil
+}
+
+// Configure sets the rules the plugin enforces.
+func (p *Plugin) Configure(s Settings) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.c = newPluginConfig(s)
+	if p.notifier == nil {
+		p.notifier = notify.NewNotifier()
+	}
+	p.notifier.Configure(s.Notifications)
+}
+
+// rule is a compiled rule.
+type rule struct {
+	name string
+	re   *regexp.Regexp
+	// message is the untranslated message from the config, if any.
+	message  string
+	severity string
+	// effectiveFrom is when the rule takes effect, zero if it applies to
+	// all PRs.
+	effectiveFrom time.Time
+}
+
+// exempts returns true if the PR was created before the rule took effect.
+// PRs without a creation time, such as titles checked before opening a PR,
+// are never exempt.
+func (r rule) exempts(pr prContext) bool {
+	return !r.effectiveFrom.IsZero() && !pr.CreatedAt.IsZero() && pr.CreatedAt.Before(r.effectiveFrom)
+}
+
+func newPluginConfig(s Settings) *pluginConfig {
+	errorMessage := fmt.Sprintf(defaultNeedsRetitleMessage, s.Regexp.String())
+	if len(s.ErrorMessage) > 0 {
+		errorMessage = s.ErrorMessage
+	}
+	c := &pluginConfig{
+		errorMessage: errorMessage,
+		re:           s.Regexp,
+		settings:     s,
+		warningLabel: s.WarningLabel,
+		locked:       map[string]bool{},
+	}
+	for _, field := range s.LockedFields {
+		c.locked[field] = true
+	}
+
+	// Dates are validated when loaded, invalid ones apply to all PRs.
+	effectiveFrom, _ := ParseEffectiveFrom(s.EffectiveFrom)
+	c.rules = append(c.rules, rule{name: regexpRule, re: s.Regexp, message: s.ErrorMessage, severity: severityOrDefault(s.Severity), effectiveFrom: effectiveFrom})
+	for _, r := range s.Rules {
+		// Rules are validated when loaded, invalid ones are skipped.
+		re, err := regexp.Compile(r.Regexp)
+		if err != nil {
+			continue
+		}
+		effectiveFrom, _ := ParseEffectiveFrom(r.EffectiveFrom)
+		c.rules = append(c.rules, rule{name: r.Name, re: re, message: r.Message, severity: severityOrDefault(r.Severity), effectiveFrom: effectiveFrom})
+	}
+	return c
+}
+
+// ParseEffectiveFrom parses the date a rule takes effect, either a date like
+// 2024-06-01, midnight UTC, or an RFC 3339 time. An empty date is the zero
+// time, the rule applies to all PRs.
+func ParseEffectiveFrom(date string) (time.Time, error) {
+	if len(date) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use a date like 2006-01-02 or an RFC 3339 time", date)
+	}
+	return t, nil
+}
+
+func severityOrDefault(severity string) string {
+	if len(severity) == 0 {
+		return SeverityError
+	}
+	return severity
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// Admin implements http.Handler. It serves the admin API used to trigger
+// scans on demand, requests need to provide the admin token as a bearer
+// token.
+type Admin struct {
+	tokenGenerator func() []byte
+	ghc            github.Client
+	log            *logrus.Entry
+	p              *plugin.Plugin
+	pluginConfig   func() *plugins.Configuration
+}
+
+func NewAdmin(tokenGenerator func() []byte, ghc github.Client, log *logrus.Entry, p *plugin.Plugin, pluginConfig func() *plugins.Configuration) *Admin {
+	return &Admin{
+		tokenGenerator: tokenGenerator,
+		ghc:            ghc,
+		log:            log,
+		p:              p,
+		pluginConfig:   pluginConfig,
+	}
+}
+
+// ServeHTTP authenticates the request and dispatches it to the endpoint.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/scan":
+		a.serveScan(w, r)
+	case "/plans":
+		a.servePlans(w, r)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (a *Admin) authorized(r *http.Request) bool {
+	token := strings.TrimSpace(string(a.tokenGenerator()))
+	if len(token) == 0 {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+// serveScan runs a scan for every enabled org and repo, or for the org,
+// repo and PR number given in the query parameters, and responds with the
+// summary of the actions taken.
+func (a *Admin) serveScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	scope, err := scopeFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	config := a.pluginConfig()
+	orgs, repos := config.EnabledReposForExternalPlugin(plugin.PluginName)
+	if err := scope.Validate(orgs, repos); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	l := a.log.WithField("scope", scope.String())
+	l.Info("Scan requested through the admin API.")
+	result, err := a.p.Scan(l, a.ghc, config, scope)
+	if errors.Is(err, plugin.ErrScanInProgress) {
+		writeError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		l.WithError(err).Error("Error during requested scan.")
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// servePlans responds with the latest plan of each PR in dry run, for every
+// PR or for the org, repo and PR number given in the query parameters.
+func (a *Admin) servePlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	scope, err := scopeFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		DryRun bool          `json:"dry_run"`
+		Plans  []plugin.Plan `json:"plans"`
+	}{
+		DryRun: a.p.DryRun(),
+		Plans:  a.p.Plans(scope, time.Time{}),
+	})
+}
+
+// scopeFromQuery returns the scope given by the org, repo and pr query
+// parameters.
+func scopeFromQuery(r *http.Request) (plugin.Scope, error) {
+	scope := plugin.Scope{
+		Org:  r.URL.Query().Get("org"),
+		Repo: r.URL.Query().Get("repo"),
+	}
+	if pr := r.URL.Query().Get("pr"); len(pr) > 0 {
+		number, err := strconv.Atoi(pr)
+		if err != nil {
+			return scope, err
+		}
+		scope.Number = number
+	}
+	return scope, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Error("Error writing response.")
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// fakePRGetter is a GitHub client serving closed PRs. When release is set,
+// getting a PR signals started and waits for release to be closed.
+type fakePRGetter struct {
+	github.Client
+	started, release chan struct{}
+}
+
+func (f *fakePRGetter) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	if f.release != nil {
+		f.started <- struct{}{}
+		<-f.release
+	}
+	return &github.PullRequest{Number: number, State: "closed"}, nil
+}
+
+func newTestAdmin(ghc github.Client) *Admin {
+	p := &plugin.Plugin{}
+	p.SetConfig("", regexp.MustCompile("^fix:.*$"))
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{"org": {{Name: plugin.PluginName}}},
+	}
+	return NewAdmin(func() []byte { return []byte("secret\n") }, ghc, logrus.WithField("plugin", plugin.PluginName), p, func() *plugins.Configuration { return config })
+}
+
+func TestAdmin(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		auth   string
+
+		expectedCode int
+	}{
+		{
+			name:         "missing token",
+			method:       http.MethodPost,
+			target:       "/scan",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "wrong token",
+			method:       http.MethodPost,
+			target:       "/scan",
+			auth:         "Bearer wrong",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "wrong method",
+			method:       http.MethodGet,
+			target:       "/scan",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "bad PR number",
+			method:       http.MethodPost,
+			target:       "/scan?org=org&repo=repo&pr=one",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "org not enabled",
+			method:       http.MethodPost,
+			target:       "/scan?org=other",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "scan",
+			method:       http.MethodPost,
+			target:       "/scan?org=org&repo=repo&pr=1",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "plans",
+			method:       http.MethodGet,
+			target:       "/plans?org=org",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "plans with wrong method",
+			method:       http.MethodPost,
+			target:       "/plans",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "unknown endpoint",
+			method:       http.MethodGet,
+			target:       "/unknown",
+			auth:         "Bearer secret",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			if len(tc.auth) > 0 {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rr := httptest.NewRecorder()
+			newTestAdmin(&fakePRGetter{}).ServeHTTP(rr, req)
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestAdminScanInProgress(t *testing.T) {
+	ghc := &fakePRGetter{started: make(chan struct{}), release: make(chan struct{})}
+	a := newTestAdmin(ghc)
+	scan := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/scan?org=org&repo=repo&pr=1", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		a.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- scan() }()
+	<-ghc.started
+
+	rr := scan()
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.Equal(t, plugin.ErrScanInProgress.Error(), body["error"])
+
+	close(ghc.release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+)
+
+type botUserClient interface {
+	BotUser() (*github.UserData, error)
+}
+
+type configLoader interface {
+	LastLoad() time.Time
+	Hash() string
+	LastError() error
+}
+
+type scanner interface {
+	LastScan() time.Time
+}
+
+// Health serves the liveness and readiness endpoints of the plugin.
+type Health struct {
+	mut     sync.Mutex
+	ghc     botUserClient
+	ca      configLoader
+	s       scanner
+	log     *logrus.Entry
+	botUser string
+}
+
+type healthStatus struct {
+	Ready       bool     `json:"ready"`
+	Reasons     []string `json:"reasons,omitempty"`
+	BotUser     string   `json:"bot_user,omitempty"`
+	ConfigAge   string   `json:"config_age,omitempty"`
+	ConfigHash  string   `json:"config_hash,omitempty"`
+	ConfigError string   `json:"config_error,omitempty"`
+	ScanAge     string   `json:"scan_age,omitempty"`
+}
+
+func NewHealth(ghc botUserClient, ca configLoader, s scanner, log *logrus.Entry) *Health {
+	return &Health{
+		ghc: ghc,
+		ca:  ca,
+		s:   s,
+		log: log,
+	}
+}
+
+// ServeMux returns a mux serving /healthz and /readyz.
+func (h *Health) ServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.ServeHealthz)
+	mux.HandleFunc("/readyz", h.ServeReadyz)
+	return mux
+}
+
+// ServeHealthz reports that the process is alive.
+func (h *Health) ServeHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// ServeReadyz reports whether the plugin config has been loaded and the bot
+// user has been resolved, along with the age and hash of the active config,
+// the error of the last config reload if it failed, and the age of the last
+// successful periodic scan.
+func (h *Health) ServeReadyz(w http.ResponseWriter, _ *http.Request) {
+	status := healthStatus{Ready: true}
+
+	if lastLoad := h.ca.LastLoad(); lastLoad.IsZero() {
+		status.Ready = false
+		status.Reasons = append(status.Reasons, "plugin config not loaded")
+	} else {
+		status.ConfigAge = time.Since(lastLoad).Round(time.Second).String()
+		status.ConfigHash = h.ca.Hash()
+	}
+	// A failed reload doesn't affect readiness, the last good config is
+	// still in use.
+	if err := h.ca.LastError(); err != nil {
+		status.ConfigError = err.Error()
+	}
+
+	if botUser, err := h.resolveBotUser(); err != nil {
+		status.Ready = false
+		status.Reasons = append(status.Reasons, "bot user not resolved: "+err.Error())
+	} else {
+		status.BotUser = botUser
+	}
+
+	if lastScan := h.s.LastScan(); !lastScan.IsZero() {
+		status.ScanAge = time.Since(lastScan).Round(time.Second).String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.log.WithError(err).Error("Error writing readiness status.")
+	}
+}
+
+// resolveBotUser asks GitHub for the bot user until it succeeds once.
+func (h *Health) resolveBotUser() (string, error) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if len(h.botUser) > 0 {
+		return h.botUser, nil
+	}
+	botUser, err := h.ghc.BotUser()
+	if err != nil {
+		return "", err
+	}
+	h.botUser = botUser.Login
+	return h.botUser, nil
+}
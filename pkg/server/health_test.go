@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/test-infra/prow/github"
+)
+
+type fakeBotUser struct {
+	err error
+}
+
+func (f *fakeBotUser) BotUser() (*github.UserData, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &github.UserData{Login: "k8s-ci-robot"}, nil
+}
+
+type fakeTimes struct {
+	lastLoad, lastScan time.Time
+}
+
+func (f *fakeTimes) LastLoad() time.Time { return f.lastLoad }
+func (f *fakeTimes) Hash() string        { return "abc" }
+func (f *fakeTimes) LastError() error    { return nil }
+func (f *fakeTimes) LastScan() time.Time { return f.lastScan }
+
+func TestServeReadyz(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lastLoad time.Time
+		botErr   error
+
+		expectedCode int
+	}{
+		{
+			name:         "config not loaded",
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "bot user not resolved",
+			lastLoad:     time.Now(),
+			botErr:       errors.New("bad credentials"),
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "ready",
+			lastLoad:     time.Now(),
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			times := &fakeTimes{lastLoad: tc.lastLoad}
+			h := NewHealth(&fakeBotUser{err: tc.botErr}, times, times, logrus.WithField("test", tc.name))
+			rr := httptest.NewRecorder()
+			h.ServeReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tc.expectedCode, rr.Code)
+		})
+	}
+}
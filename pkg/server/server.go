@@ -20,7 +20,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/ouzi-dev/needs-retitle/pkg/metrics"
 	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
 	"github.com/sirupsen/logrus"
 	"k8s.io/test-infra/prow/github"
@@ -70,7 +72,9 @@ func (s *Server) handleEvent(eventType, eventGUID string, payload []byte) error
 		if err := json.Unmarshal(payload, &pre); err != nil {
 			return err
 		}
+		metrics.WebhookEvents.WithLabelValues(eventType, string(pre.Action)).Inc()
 		go func() {
+			defer observeLatency(eventType, time.Now())
 			if err := s.p.HandlePullRequestEvent(l, s.ghc, &pre); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
@@ -80,13 +84,20 @@ func (s *Server) handleEvent(eventType, eventGUID string, payload []byte) error
 		if err := json.Unmarshal(payload, &ice); err != nil {
 			return err
 		}
+		metrics.WebhookEvents.WithLabelValues(eventType, string(ice.Action)).Inc()
 		go func() {
+			defer observeLatency(eventType, time.Now())
 			if err := s.p.HandleIssueCommentEvent(l, s.ghc, &ice); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
 	default:
+		metrics.WebhookEvents.WithLabelValues(eventType, "").Inc()
 		s.log.Debugf("received an event of type %q but didn't ask for it", eventType)
 	}
 	return nil
 }
+
+func observeLatency(eventType string, start time.Time) {
+	metrics.HandlerLatency.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// Validator implements http.Handler. It checks titles against the rules the
+// plugin enforces without calling GitHub, so tools can check a title before
+// a PR is opened.
+type Validator struct {
+	log *logrus.Entry
+	p   *plugin.Plugin
+}
+
+type validateRequest struct {
+	Org        string `json:"org"`
+	Repo       string `json:"repo"`
+	BaseBranch string `json:"base_branch"`
+	Title      string `json:"title"`
+}
+
+func NewValidator(log *logrus.Entry, p *plugin.Plugin) *Validator {
+	return &Validator{
+		log: log,
+		p:   p,
+	}
+}
+
+// ServeHTTP evaluates the title in the request and responds with the verdict.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var req validateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Org) == 0 || len(req.Repo) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("org and repo are required"))
+		return
+	}
+
+	evaluation, err := v.p.Evaluate(req.Org, req.Repo, req.BaseBranch, req.Title)
+	if errors.Is(err, plugin.ErrNotConfigured) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		v.log.WithError(err).Error("Error evaluating title.")
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, evaluation)
+}
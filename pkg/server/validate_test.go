@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ouzi-dev/needs-retitle/pkg/plugin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		configured bool
+
+		expectedCode    int
+		expectedVerdict string
+	}{
+		{
+			name:            "title follows the rules",
+			method:          http.MethodPost,
+			body:            `{"org": "org", "repo": "repo", "title": "fix: typo"}`,
+			configured:      true,
+			expectedCode:    http.StatusOK,
+			expectedVerdict: plugin.VerdictPass,
+		},
+		{
+			name:            "title breaks the rules",
+			method:          http.MethodPost,
+			body:            `{"org": "org", "repo": "repo", "title": "typo"}`,
+			configured:      true,
+			expectedCode:    http.StatusOK,
+			expectedVerdict: plugin.VerdictFail,
+		},
+		{
+			name:         "wrong method",
+			method:       http.MethodGet,
+			configured:   true,
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "bad body",
+			method:       http.MethodPost,
+			body:         `{"org": "org",`,
+			configured:   true,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "missing repo",
+			method:       http.MethodPost,
+			body:         `{"org": "org", "title": "fix: typo"}`,
+			configured:   true,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "not configured",
+			method:       http.MethodPost,
+			body:         `{"org": "org", "repo": "repo", "title": "fix: typo"}`,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &plugin.Plugin{}
+			if tc.configured {
+				p.SetConfig("", regexp.MustCompile("^fix:.*$"))
+			}
+			req := httptest.NewRequest(tc.method, "/validate", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			NewValidator(logrus.WithField("plugin", plugin.PluginName), p).ServeHTTP(rr, req)
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+			if len(tc.expectedVerdict) > 0 {
+				var evaluation plugin.Evaluation
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&evaluation))
+				assert.Equal(t, tc.expectedVerdict, evaluation.Verdict)
+			}
+		})
+	}
+}